@@ -3,9 +3,9 @@ package fondy
 import (
 	"github.com/satori/go.uuid"
 	"encoding/base64"
+	"context"
 	"encoding/json"
 	"crypto/sha1"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -22,9 +22,19 @@ type Response struct {
 	ErrorMessage	string 	`json:"error_message"`
 }
 
+// ApiError is an error response of Fondy, the request was refused and had no effect.
+type ApiError struct {
+	Code		int
+	Message		string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
 func (r *Response) GetError() error {
 	if r.ErrorCode > 0 {
-		return errors.New(fmt.Sprintf("%d: %s", r.ErrorCode, r.ErrorMessage))
+		return &ApiError{Code: r.ErrorCode, Message: r.ErrorMessage}
 	}
 	return nil
 }
@@ -35,11 +45,33 @@ type ApiOptions struct {
 	RequestType		string		// request type allowed json, xml, form
 	ApiDomain		string 		// api domain
 	ApiProtocol		string 		// allowed protocols 1.0, 2.0
+	Keys			KeyProvider	// rotating keys, SecretKey is used when nil
+	StrictSignature		bool		// reject every unsigned response, including errors and lists
+	Timeout			time.Duration	// http request timeout, none when 0
+	Transport		http.RoundTripper	// http transport, http.DefaultTransport when nil
+	MaxResponseSize		int64		// response body limit, DefaultMaxResponseSize when 0, none when negative
+	Metrics			MetricsCollector	// callbacks and their signature failures are reported to it when set
 }
 
 type Api struct {
 	Options			*ApiOptions
 	ApiUrl 			string
+	chain			*chain		// shared with the WithContext copies
+	ctx			context.Context
+}
+
+// WithContext returns a copy of the api whose calls are bound to ctx, it shares the middleware chain.
+func (a *Api) WithContext(ctx context.Context) *Api {
+	c := *a
+	c.ctx = ctx
+	return &c
+}
+
+func (a *Api) context() context.Context {
+	if a.ctx != nil {
+		return a.ctx
+	}
+	return context.Background()
 }
 
 func (a *Api) headers() map[string]string {
@@ -66,142 +98,277 @@ func (a *Api) ToB64(data interface{}) (string, error) {
 	return base64.StdEncoding.EncodeToString(output), nil
 }
 
-func (a *Api) GetSignature(data string) string {
+func signature(secret, data string) string {
 
-	s, h := strings.Join([]string{a.Options.SecretKey, data}, "|"), sha1.New()
+	s, h := strings.Join([]string{secret, data}, "|"), sha1.New()
 	io.WriteString(h, s)
 
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func (a *Api) prepereData(body interface{}) ([]byte, error) {
-	output, err := json.Marshal(body)
+// GetSignature signs data with the primary key, it is empty when there is no secret key.
+func (a *Api) GetSignature(data string) string {
+	sign, _ := a.Sign(data)
+	return sign
+}
+
+// Sign signs data with the primary key and fails with ErrNoSecretKey when there is none.
+func (a *Api) Sign(data string) (string, error) {
+	key, err := a.signingKey()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return signature(key.Secret, data), nil
+}
 
+func (a *Api) orderData(body interface{}) (map[string]interface{}, error) {
 	var data map[string]interface{}
-	if err := json.Unmarshal(output, &data); err != nil {
+
+	if m, ok := body.(map[string]interface{}); ok {
+		data = make(map[string]interface{}, len(m) + 1)
+		for k, v := range m {
+			data[k] = v
+		}
+	} else if order, ok, err := structOrder(body); err != nil {
 		return nil, err
+	} else if ok {
+		data = order
+	} else {
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		if err := marshalTo(buf, body); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+			return nil, err
+		}
 	}
 
+	if data == nil {
+		data = map[string]interface{}{}
+	}
 	if v, ok := data["merchant_id"]; !ok || v == "" {
 		data["merchant_id"] = a.Options.MerchantID
 	}
 
-	if v, ok := data["reservation_data"]; ok {
-		if value, err := a.ToB64(v); err != nil {
-			return nil, err
-		} else {
-			data["reservation_data"] = value
-		} 
+	for _, field := range []string{"reservation_data", "receipt_data"} {
+		if v, ok := data[field]; ok {
+			if value, err := a.ToB64(v); err != nil {
+				return nil, err
+			} else {
+				data[field] = value
+			} 
+		}
 	}
+	return data, nil
+}
 
-	if b64Data, err := a.ToB64(map[string]interface{}{"order": data}); err != nil {
+func (a *Api) envelope(data map[string]interface{}) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := a.writeEnvelope(buf, data); err != nil {
 		return nil, err
-	} else {
-		return json.Marshal(map[string]interface{}{
-			"request": map[string]interface{}{
-				"data": b64Data,
-				"version": a.Options.ApiProtocol,
-				"signature": a.GetSignature(b64Data),
-			},
-		})
 	}
+	return append([]byte(nil), buf.Bytes()...), nil
 }
 
-func (a *Api) CheckSignature(response map[string]interface{}) error {
-	switch data := response["data"].(type) {
-	case string:
-		switch signature := response["signature"].(type) {
-		case string:
-			if sign := a.GetSignature(data); sign == signature {
-				return nil
-			} else {
-				return errors.New(fmt.Sprintf("Signature does not match: %s != %s", sign, signature))				
-			}
-		}
-	}
-	switch err := response["error_message"].(type) {
-	case string:
-		return errors.New(fmt.Sprintf("%v: %s", response["error_code"], err))
-		
+func (a *Api) prepereData(body interface{}) ([]byte, error) {
+	data, err := a.orderData(body)
+	if err != nil {
+		return nil, err
 	}
-	return errors.New("Signature does not match")
+	return a.envelope(data)
+}
+
+func (a *Api) CheckSignature(response map[string]interface{}) error {
+	_, err := a.checkSignature(response)
+	return err
 }
 
 func (a *Api) GetResponse(content []byte, obj interface{}, checkSignature bool) error {
-	var data map[string]interface{}
-	if err := json.Unmarshal(content, &data); err != nil {
-		return err
+	_, err := a.decode(content, obj, checkSignature || a.Options.StrictSignature, a.Options.StrictSignature)
+	return err
+}
+
+// responseStatus is the status of a response found at its top level or in its order.
+type responseStatus struct {
+	Response
+	Order		Response	`json:"order"`
+}
+
+func (r responseStatus) result() Response {
+	if r.ResponseStatus == "" && r.ErrorCode == 0 {
+		return r.Order
+	}
+	return r.Response
+}
+
+// responseValue decodes the value of the response key in place, json.Unmarshal hands
+// it a slice of the body so the value is not copied or parsed into an intermediate.
+type responseValue struct {
+	a		*Api
+	obj		interface{}
+	checkSignature	bool
+	strict		bool
+	found		bool
+	result		Response
+	err		error
+}
+
+func (v *responseValue) UnmarshalJSON(raw []byte) error {
+	v.found = true
+	v.result, v.err = v.a.decodeResponse(raw, v.obj, v.checkSignature, v.strict)
+	return nil
+}
+
+// errorCode reads error_code, which Fondy sends as a number or a string.
+func errorCode(v interface{}) int {
+	code, _ := strconv.Atoi(strings.TrimSpace(toString(v)))
+	return code
+}
+
+// decode parses the envelope once, decoding the response straight into obj,
+// and returns the response status for Exchange.Result.
+func (a *Api) decode(content []byte, obj interface{}, checkSignature, strict bool) (Response, error) {
+	value := &responseValue{a: a, obj: obj, checkSignature: checkSignature, strict: strict}
+	envelope := struct {
+		Response	*responseValue	`json:"response"`
+	}{value}
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return Response{}, err
 	}
+	if !value.found {
+		return Response{}, errors.New(fmt.Sprintf("Response body is empty: %s", content))
+	}
+	return value.result, value.err
+}
+
+func (a *Api) decodeResponse(raw []byte, obj interface{}, checkSignature, strict bool) (Response, error) {
+	switch {
+	case raw[0] == '{':
+		var response struct {
+			Data		*string		`json:"data"`
+			Signature	*string		`json:"signature"`
+			ErrorCode	interface{}	`json:"error_code"`
+			ErrorMessage	*string		`json:"error_message"`
+			ResponseStatus	string		`json:"response_status"`
+			Order		Response	`json:"order"`
+		}
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return Response{}, err
+		}
+
+		status := responseStatus{Response: Response{ResponseStatus: response.ResponseStatus, ErrorCode: errorCode(response.ErrorCode)}, Order: response.Order}
+		if response.ErrorMessage != nil {
+			status.ErrorMessage = *response.ErrorMessage
+		}
 
-	switch response := data["response"].(type)  {
-	case map[string]interface{}:
 		if checkSignature {
-			if err := a.CheckSignature(response); err != nil {
-				return err
+			fields := map[string]interface{}{"error_code": response.ErrorCode}
+			if response.Data != nil {
+				fields["data"] = *response.Data
 			}
-		}
-		switch dataString := response["data"].(type) {
-		case string:
-			if sd, err := base64.StdEncoding.DecodeString(dataString); err != nil {
-				return err
-			} else {
-				return json.Unmarshal(sd, &obj)
+			if response.Signature != nil {
+				fields["signature"] = *response.Signature
 			}
-		default:
-			if output, err := json.Marshal(response); err != nil {
-				return err
-			} else {
-				return json.Unmarshal(output, &obj)
+			if response.ErrorMessage != nil {
+				fields["error_message"] = *response.ErrorMessage
+			}
+			if err := a.CheckSignature(fields); err != nil {
+				return status.result(), err
 			}
 		}
-	case []interface{}:
-		if output, err := json.Marshal(response); err != nil {
-			return err
-		} else {
-			return json.Unmarshal(output, &obj)
-		}	
+
+		if response.Data != nil {
+			var payload json.RawMessage
+			if err := json.NewDecoder(base64.NewDecoder(base64.StdEncoding, strings.NewReader(*response.Data))).Decode(&payload); err != nil {
+				return Response{}, err
+			}
+			status = responseStatus{}
+			json.Unmarshal(payload, &status)
+			return status.result(), json.Unmarshal(payload, &obj)
+		}
+		return status.result(), json.Unmarshal(raw, &obj)
+	case raw[0] == '[':
+		if strict {
+			return Response{}, &SignatureError{Err: ErrSignatureMissing, Detail: "list response"}
+		}
+		return Response{}, json.Unmarshal(raw, &obj)
 	}
-	return errors.New(fmt.Sprintf("Response body is empty: %v", data))
+	return Response{}, errors.New(fmt.Sprintf("Response body is empty: %s", raw))
 }
 
-func (a *Api) post(path string, body interface{}, obj interface{}, checkSignature bool) error {
+func (a *Api) transport(ex *Exchange) error {
 
-	output, err := a.prepereData(body)
-	if err != nil {
+	buf := getBuffer()
+	if err := a.writeEnvelope(buf, ex.Order); err != nil {
+		putBuffer(buf)
 		return err
 	}
 
-	req, err := http.NewRequest("POST", a.ApiUrl + path, strings.NewReader(string(output)))
+	body := newPooledBody(buf)
+	req, err := http.NewRequestWithContext(ex.Context, "POST", a.ApiUrl + "/" + ex.Endpoint + "/", body)
 	if err != nil {
+		body.Close()
 		return err
 	}
+	req.ContentLength = int64(buf.Len())
+	req.Header = ex.Header
+	ex.Request = req
 
-	for k, v := range a.headers() {
-		req.Header.Add(k, v)
-	}
-
-	client := &http.Client{}
+	client := &http.Client{Timeout: a.Options.Timeout, Transport: a.Options.Transport}
 	if resp, err := client.Do(req); err != nil {
 		return err 
 	} else {
 		defer resp.Body.Close()
 		
-		if content, err := ioutil.ReadAll(resp.Body); err != nil {
+		if content, err := readBody(resp.Body, a.maxResponseSize()); errors.Is(err, ErrResponseTooLarge) {
+			ex.Response, ex.StatusCode, ex.Body = resp, resp.StatusCode, content
+			return &ResponseError{StatusCode: resp.StatusCode, Body: content, Err: err}
+		} else if err != nil {
 			return err
 		} else {
+			ex.Response, ex.StatusCode, ex.Body = resp, resp.StatusCode, content
+			ex.Duration = time.Since(ex.Start)
 
-			if resp.StatusCode != 200 && resp.StatusCode != 201 {
-				return errors.New(fmt.Sprintf("Response code is: %d; content: %s", resp.StatusCode, string(content)))
-			}
-
-			return a.GetResponse(content, obj, checkSignature)
+			return ex.Decode()
 		}
 	}
 }
 
+func (a *Api) post(path string, body interface{}, obj interface{}, checkSignature bool) error {
+	ex, err := a.exchange(path, body, obj, checkSignature)
+	if err != nil {
+		return err
+	}
+	return a.handler()(ex)
+}
+
+func (a *Api) exchange(path string, body interface{}, obj interface{}, checkSignature bool) (*Exchange, error) {
+
+	data, err := a.orderData(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ex := &Exchange{
+		Context: a.context(),
+		Endpoint: strings.Trim(path, "/"),
+		Order: data,
+		Header: http.Header{},
+		Start: time.Now(),
+		api: a,
+		target: obj,
+		checkSignature: checkSignature,
+	}
+	for k, v := range a.headers() {
+		ex.Header.Add(k, v)
+	}
+	return ex, nil
+}
+
 func (a *Api) checkout(data *Checkout, typ string, checkSignature bool) (string, error) {
 
 	var resp struct {
@@ -220,14 +387,17 @@ func (a *Api) checkout(data *Checkout, typ string, checkSignature bool) (string,
 	}
 }
 
+// CheckoutUrl creates a hosted checkout, the response is signed.
 func (a *Api) CheckoutUrl(data *Checkout) (string, error) {
 	return a.checkout(data, "url", true)
 }
 
+// CheckoutToken creates an embedded checkout token, the response is not verified unless StrictSignature is set.
 func (a *Api) CheckoutToken(data *Checkout) (string, error) {
 	return a.checkout(data, "token", false)
 }
 
+// CheckoutVerification creates a card verification checkout, the response is signed.
 func (a *Api) CheckoutVerification(data *Checkout) (string, error) {
 	data.Verification = "Y"
 	if data.VerificationType == "" {
@@ -236,14 +406,19 @@ func (a *Api) CheckoutVerification(data *Checkout) (string, error) {
 	return a.CheckoutUrl(data)
 }
 
+// CheckoutSubscription creates a recurring checkout, the response is signed.
 func (a *Api) CheckoutSubscription(data *Checkout) (string, error) {
 	data.Verification = "Y"
 	return a.CheckoutUrl(data)
 }
 
+// PcidssStep1 charges card data directly, the response is signed.
 func (a *Api) PcidssStep1(data *PCIDSSOneStep) (map[string]interface{}, error) {
 	var resp map[string]interface{}
 
+	if err := data.Validate(); err != nil {
+		return resp, err
+	}
 	if err := a.post("/3dsecure_step1/", data, &resp, true); err != nil {
 		return resp, err
 	} else if code, ok := resp["error_code"]; ok && code.(int) > 0 {
@@ -252,6 +427,7 @@ func (a *Api) PcidssStep1(data *PCIDSSOneStep) (map[string]interface{}, error) {
 	return resp, nil
 }
 
+// PcidssStep2 completes 3DSecure of PcidssStep1, the response is signed.
 func (a *Api) PcidssStep2(data *PCIDSSTwoStep) (map[string]interface{}, error) {
 	var resp struct {
 		Response
@@ -265,12 +441,16 @@ func (a *Api) PcidssStep2(data *PCIDSSTwoStep) (map[string]interface{}, error) {
 	}
 }
 
+// P2Pcredit sends money to a card, the response is signed.
 func (a *Api) P2Pcredit(data *P2Pcredit) (map[string]interface{}, error) {
 	var resp struct {
 		Response
 		Order map[string]interface{}	`json:"order"`
 	}
 	
+	if err := data.Validate(); err != nil {
+		return resp.Order, err
+	}
 	if err := a.post("/p2pcredit/", data, &resp, true); err != nil {
 		return resp.Order, err
 	} else {
@@ -278,6 +458,7 @@ func (a *Api) P2Pcredit(data *P2Pcredit) (map[string]interface{}, error) {
 	}
 }
 
+// GetReports lists orders, Fondy returns the list unsigned so it fails with StrictSignature.
 func (a *Api) GetReports(dateFrom, dateTo time.Time) ([]map[string]interface{}, error) {
 	var resp []map[string]interface{}
 	
@@ -293,6 +474,7 @@ func (a *Api) GetReports(dateFrom, dateTo time.Time) ([]map[string]interface{},
 	return resp, nil
 }
 
+// Recurring charges a rectoken, the response is signed.
 func (a *Api) Recurring(data *RecurringBody) (map[string]interface{}, error) {
 	var resp struct {
 		Response
@@ -306,6 +488,7 @@ func (a *Api) Recurring(data *RecurringBody) (map[string]interface{}, error) {
 	}
 }
 
+// Settlement splits a payment between receivers, the response is signed.
 func (a *Api) Settlement(data *Settlement) (int64, error) {
 
 	if data.OrderID == "" {
@@ -325,6 +508,7 @@ func (a *Api) Settlement(data *Settlement) (int64, error) {
 	}
 }
 
+// Capture captures a preauth, the response is signed.
 func (a *Api) Capture(data *Capture) (string, error) {
 	var resp struct {
 		Response
@@ -339,6 +523,7 @@ func (a *Api) Capture(data *Capture) (string, error) {
 	}
 }
 
+// Reverse refunds an order, the response is signed.
 func (a *Api) Reverse(data *Reverse) (string, error) {
 	var resp struct {
 		Response
@@ -353,6 +538,7 @@ func (a *Api) Reverse(data *Reverse) (string, error) {
 	}
 }
 
+// GetOrderStatus returns the order, the response is signed.
 func (a *Api) GetOrderStatus(orderID string) (map[string]interface{}, error) {
 	var resp struct {
 		Response
@@ -365,6 +551,7 @@ func (a *Api) GetOrderStatus(orderID string) (map[string]interface{}, error) {
 	}
 }
 
+// TransactionList lists order transactions, Fondy returns the list unsigned so it fails with StrictSignature.
 func (a *Api) TransactionList(orderID string) ([]map[string]interface{}, error) {
 	var resp []map[string]interface{}
 	if err := a.post("/transaction_list/", map[string]interface{}{"order_id": orderID}, &resp, true); err != nil {
@@ -374,6 +561,7 @@ func (a *Api) TransactionList(orderID string) ([]map[string]interface{}, error)
 	}
 }
 
+// AtolLogs returns fiscal receipt logs, the response is signed.
 func (a *Api) AtolLogs(orderID string) (interface{}, error) {
 	var resp struct {
 		Response
@@ -392,13 +580,15 @@ func NewApi(options *ApiOptions) *Api {
 		options.RequestType = "json"
 	}
 	
-	if options.MerchantID == 0 || options.SecretKey == "" {
+	if options.MerchantID == 0 || (options.SecretKey == "" && (options.Keys == nil || len(usableKeys(options.Keys.Keys())) == 0)) {
 		if id, err := strconv.Atoi(os.Getenv("CLOUDIPSP_MERCHANT_ID")); err != nil {
 			panic("Incorrect 'CLOUDIPSP_MERCHANT_ID' env variable: " + err.Error())
 		} else {
 			options.MerchantID = int64(id)
 		}
-		options.SecretKey = os.Getenv("CLOUDIPSP_SECRETKEY")
+		if options.SecretKey = os.Getenv("CLOUDIPSP_SECRETKEY"); options.SecretKey == "" && (options.Keys == nil || len(usableKeys(options.Keys.Keys())) == 0) {
+			panic("Empty 'CLOUDIPSP_SECRETKEY' env variable")
+		}
 	}
 
 	if options.ApiDomain == "" {
@@ -417,5 +607,5 @@ func NewApi(options *ApiOptions) *Api {
 		panic("Only 'json' encoding allowed")
 	}
 
-	return &Api{Options: options, ApiUrl: fmt.Sprintf("https://%s/api", options.ApiDomain)}
+	return &Api{Options: options, ApiUrl: fmt.Sprintf("https://%s/api", options.ApiDomain), chain: &chain{}}
 }
@@ -33,14 +33,14 @@ var testData map[string]map[string]interface{} = map[string]map[string]interface
 		"amount": "100",
 		"card_number": "4444555511116666",
 		"cvv2": "123",
-		"expiry_date": "1224",
+		"expiry_date": "1230",
 	},
 	"payment_pcidss_3ds": map[string]interface{}{
 		"currency": "RUB",
 		"amount": "100",
 		"card_number": "4444555566661111",
 		"cvv2": "123",
-		"expiry_date": "1224",
+		"expiry_date": "1230",
 	},  
 }
 
@@ -115,8 +115,8 @@ func TestPcidss(t *testing.T) {
 	data := &PCIDSSOneStep{
 		Amount: testData["payment_pcidss_non3ds"]["amount"].(string),
 		Currency: testData["payment_pcidss_non3ds"]["currency"].(string),
-		CardNumber: testData["payment_pcidss_non3ds"]["card_number"].(string),
-		Cvv2: testData["payment_pcidss_non3ds"]["cvv2"].(string),
+		CardNumber: Sensitive(testData["payment_pcidss_non3ds"]["card_number"].(string)),
+		Cvv2: Sensitive(testData["payment_pcidss_non3ds"]["cvv2"].(string)),
 		ExpiryDate: testData["payment_pcidss_non3ds"]["expiry_date"].(string),
 		Preauth: "Y",
 		RequiredRectoken: "Y",
@@ -143,7 +143,7 @@ func TestPcidss(t *testing.T) {
 func TestP2Pcredit(t *testing.T) {
 	a := NewApi(&ApiOptions{MerchantID: 1000, SecretKey: "testcredit"})
 	data := &P2Pcredit{
-		ReceiverCardNumber: testData["payment_p2p"]["receiver_card_number"].(string),
+		ReceiverCardNumber: Sensitive(testData["payment_p2p"]["receiver_card_number"].(string)),
 		Currency: testData["payment_p2p"]["currency"].(string),
 		Amount: testData["payment_p2p"]["amount"].(string),
 		OrderID: uuid.NewV4().String(),
@@ -169,8 +169,8 @@ func CreateOrder(orderID string) (map[string]interface{}, error) {
 	data := &PCIDSSOneStep{
 		Amount: testData["payment_pcidss_non3ds"]["amount"].(string),
 		Currency: testData["payment_pcidss_non3ds"]["currency"].(string),
-		CardNumber: testData["payment_pcidss_non3ds"]["card_number"].(string),
-		Cvv2: testData["payment_pcidss_non3ds"]["cvv2"].(string),
+		CardNumber: Sensitive(testData["payment_pcidss_non3ds"]["card_number"].(string)),
+		Cvv2: Sensitive(testData["payment_pcidss_non3ds"]["cvv2"].(string)),
 		ExpiryDate: testData["payment_pcidss_non3ds"]["expiry_date"].(string),
 		Preauth: "Y",
 		RequiredRectoken: "Y",
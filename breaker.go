@@ -0,0 +1,260 @@
+package fondy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"fmt"
+)
+
+var ErrCircuitOpen = errors.New("Circuit breaker is open")
+
+// CircuitOpenError is returned without calling Fondy while the group circuit is open.
+type CircuitOpenError struct {
+	Group		string
+	RetryAfter	time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s for %s, retry after %s", ErrCircuitOpen, e.Group, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// EndpointGroups maps endpoints to the groups that share a circuit, unknown endpoints are "other".
+var EndpointGroups = map[string]string{
+	"checkout/url":		"checkout",
+	"checkout/token":	"checkout",
+	"3dsecure_step1":	"pcidss",
+	"3dsecure_step2":	"pcidss",
+	"recurring":		"pcidss",
+	"p2pcredit":		"payouts",
+	"settlement":		"payouts",
+	"capture":		"operations",
+	"reverse/order_id":	"operations",
+	"status/order_id":	"read",
+	"transaction_list":	"read",
+	"reports":		"read",
+	"get_atol_logs":	"read",
+}
+
+type BreakerOptions struct {
+	FailureRatio		float64		// failures / calls that opens the circuit, 0.5 by default
+	MinRequests		int		// calls in the window before the ratio is checked, 10 by default
+	Window			time.Duration	// counting window, one minute by default
+	OpenTimeout		time.Duration	// how long the circuit stays open, 30 seconds by default
+	HalfOpenRequests	int		// trial calls in half-open state, 1 by default
+	Groups			map[string]string			// overrides EndpointGroups
+	IsFailure		func(ex *Exchange, err error) bool	// network errors, 5xx and 429 by default
+	OnStateChange		func(group string, from, to BreakerState)
+}
+
+type breaker struct {
+	state		BreakerState
+	calls		int
+	failures	int
+	windowStart	time.Time
+	openedAt	time.Time
+	trials		int
+}
+
+// CircuitBreaker fails fast while Fondy is degraded, separately per endpoint group.
+type CircuitBreaker struct {
+	options		BreakerOptions
+	now		func() time.Time
+
+	mu		sync.Mutex
+	groups		map[string]*breaker
+	changes		[]transition	// reported by unlock, outside of mu
+}
+
+type transition struct {
+	group		string
+	from, to	BreakerState
+}
+
+func NewCircuitBreaker(options BreakerOptions) *CircuitBreaker {
+	if options.FailureRatio == 0 {
+		options.FailureRatio = 0.5
+	}
+	if options.MinRequests == 0 {
+		options.MinRequests = 10
+	}
+	if options.Window == 0 {
+		options.Window = time.Minute
+	}
+	if options.OpenTimeout == 0 {
+		options.OpenTimeout = 30 * time.Second
+	}
+	if options.HalfOpenRequests == 0 {
+		options.HalfOpenRequests = 1
+	}
+	if options.IsFailure == nil {
+		options.IsFailure = isDegraded
+	}
+	return &CircuitBreaker{options: options, now: time.Now, groups: map[string]*breaker{}}
+}
+
+// isDegraded tells Fondy failures from declined payments and caller errors.
+func isDegraded(ex *Exchange, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return ex.StatusCode == 0 || ex.StatusCode >= 500 || ex.StatusCode == 429
+}
+
+func (c *CircuitBreaker) group(endpoint string) string {
+	if group, ok := c.options.Groups[endpoint]; ok {
+		return group
+	}
+	if group, ok := EndpointGroups[endpoint]; ok {
+		return group
+	}
+	return "other"
+}
+
+func (c *CircuitBreaker) breaker(group string) *breaker {
+	b, ok := c.groups[group]
+	if !ok {
+		b = &breaker{windowStart: c.now()}
+		c.groups[group] = b
+	}
+	return b
+}
+
+func (c *CircuitBreaker) setState(group string, b *breaker, state BreakerState) {
+	from := b.state
+	if from == state {
+		return
+	}
+	b.state, b.calls, b.failures, b.trials = state, 0, 0, 0
+	b.windowStart = c.now()
+	if state == BreakerOpen {
+		b.openedAt = c.now()
+	}
+	if c.options.OnStateChange != nil {
+		c.changes = append(c.changes, transition{group, from, state})
+	}
+}
+
+// unlock releases mu and then calls OnStateChange, so the hook may use the breaker.
+func (c *CircuitBreaker) unlock() {
+	changes := c.changes
+	c.changes = nil
+	c.mu.Unlock()
+
+	for _, t := range changes {
+		c.options.OnStateChange(t.group, t.from, t.to)
+	}
+}
+
+// State returns the circuit state of an endpoint group.
+func (c *CircuitBreaker) State(group string) BreakerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.breaker(group)
+	if b.state == BreakerOpen && c.now().Sub(b.openedAt) >= c.options.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (c *CircuitBreaker) allow(group string) error {
+	c.mu.Lock()
+	defer c.unlock()
+
+	b := c.breaker(group)
+	switch b.state {
+	case BreakerOpen:
+		if wait := c.options.OpenTimeout - c.now().Sub(b.openedAt); wait > 0 {
+			return &CircuitOpenError{Group: group, RetryAfter: wait}
+		}
+		c.setState(group, b, BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.trials >= c.options.HalfOpenRequests {
+			return &CircuitOpenError{Group: group}
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// cancel gives back the trial slot of a call cancelled by the caller, Fondy never
+// answered it so it tells nothing about the group.
+func (c *CircuitBreaker) cancel(group string) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if b := c.breaker(group); b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+func (c *CircuitBreaker) record(group string, failed bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	b := c.breaker(group)
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			c.setState(group, b, BreakerOpen)
+			return
+		}
+		if b.calls++; b.calls >= c.options.HalfOpenRequests {
+			c.setState(group, b, BreakerClosed)
+		}
+	case BreakerClosed:
+		if c.now().Sub(b.windowStart) >= c.options.Window {
+			b.calls, b.failures, b.windowStart = 0, 0, c.now()
+		}
+		b.calls++
+		if failed {
+			b.failures++
+		}
+		if b.calls >= c.options.MinRequests && float64(b.failures) / float64(b.calls) >= c.options.FailureRatio {
+			c.setState(group, b, BreakerOpen)
+		}
+	}
+}
+
+func (c *CircuitBreaker) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			group := c.group(ex.Endpoint)
+			if err := c.allow(group); err != nil {
+				return err
+			}
+			err := next(ex)
+			if errors.Is(err, context.Canceled) {
+				c.cancel(group)
+				return err
+			}
+			c.record(group, c.options.IsFailure(ex, err))
+			return err
+		}
+	}
+}
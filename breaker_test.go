@@ -0,0 +1,82 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"net/http"
+	"testing"
+	"context"
+	"errors"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	healthy := false
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"response": {"response_status": "success", "token": "abc"}}`))
+	}))
+	defer server.Close()
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test", Timeout: time.Second})
+	a.ApiUrl = server.URL + "/api"
+
+	now := time.Now()
+	var transitions []string
+	var cb *CircuitBreaker
+	cb = NewCircuitBreaker(BreakerOptions{MinRequests: 4, OpenTimeout: time.Minute, OnStateChange: func(group string, from, to BreakerState) {
+		if state := cb.State(group); state != to {
+			t.Errorf("state in hook is %s, expected %s", state, to)
+		}
+		transitions = append(transitions, group + ":" + from.String() + "->" + to.String())
+	}})
+	cb.now = func() time.Time { return now }
+	a.Use(cb.Middleware())
+
+	for i := 0; i < 6; i++ {
+		a.CheckoutToken(&Checkout{OrderID: "1"})
+	}
+	if hits != 4 || cb.State("checkout") != BreakerOpen || cb.State("read") != BreakerClosed {
+		t.Errorf("circuit is not open after %d hits: %v", hits, cb.State("checkout"))
+	}
+
+	_, err := a.CheckoutToken(&Checkout{OrderID: "1"})
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) || open.Group != "checkout" {
+		t.Errorf("expected open circuit error, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := a.CheckoutToken(&Checkout{OrderID: "1"}); err == nil || cb.State("checkout") != BreakerOpen {
+		t.Error("failed trial does not reopen the circuit")
+	}
+
+	now = now.Add(time.Minute)
+	healthy = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.WithContext(ctx).CheckoutToken(&Checkout{OrderID: "1"}); !errors.Is(err, context.Canceled) || cb.State("checkout") != BreakerHalfOpen {
+		t.Errorf("cancelled trial decides the circuit: %v %s", err, cb.State("checkout"))
+	}
+	if token, err := a.CheckoutToken(&Checkout{OrderID: "1"}); err != nil || token != "abc" {
+		t.Fatalf("trial call failed: %v", err)
+	}
+	if cb.State("checkout") != BreakerClosed {
+		t.Error("successful trial does not close the circuit")
+	}
+
+	expected := []string{"checkout:closed->open", "checkout:open->half-open", "checkout:half-open->open", "checkout:open->half-open", "checkout:half-open->closed"}
+	if len(transitions) != len(expected) {
+		t.Fatalf("unexpected transitions: %v", transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("unexpected transitions: %v", transitions)
+			break
+		}
+	}
+}
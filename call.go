@@ -0,0 +1,71 @@
+package fondy
+
+import (
+	"encoding/json"
+	"net/http"
+	"context"
+	"bytes"
+)
+
+// CallOptions tune a Call, nil means a signed response with the result under "order".
+type CallOptions struct {
+	Unsigned	bool		// do not verify the response signature, StrictSignature still applies
+	Field		string		// response object holding the result, "order" by default, the whole response when absent
+	Header		http.Header	// sent in addition to the default headers
+}
+
+// Call posts req to an endpoint through the middleware chain and decodes the
+// result into Resp. Object responses are checked for Fondy errors, array
+// responses are decoded as is.
+func Call[Req, Resp any](ctx context.Context, api *Api, path string, req Req, opts *CallOptions) (Resp, error) {
+	var (
+		result	Resp
+		raw	json.RawMessage
+	)
+	if opts == nil {
+		opts = &CallOptions{}
+	}
+
+	ex, err := api.WithContext(ctx).exchange(path, req, &raw, !opts.Unsigned)
+	if err != nil {
+		return result, err
+	}
+	for k, values := range opts.Header {
+		for _, v := range values {
+			ex.Header.Add(k, v)
+		}
+	}
+	if err := api.handler()(ex); err != nil {
+		return result, err
+	}
+
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		return result, json.Unmarshal(raw, &result)
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return result, err
+	}
+
+	var top Response
+	if err := json.Unmarshal(raw, &top); err != nil {
+		return result, err
+	}
+
+	field := opts.Field
+	if field == "" {
+		field = "order"
+	}
+	content, ok := object[field]
+	if !ok {
+		content = raw
+	} else if top.ErrorCode == 0 {
+		json.Unmarshal(content, &top)
+	}
+
+	if err := json.Unmarshal(content, &result); err != nil {
+		return result, err
+	}
+	return result, top.GetError()
+}
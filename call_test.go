@@ -0,0 +1,85 @@
+package fondy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		switch order["order_id"] {
+		case "declined":
+			return map[string]interface{}{"order": map[string]interface{}{
+				"response_status": "failure",
+				"error_code": 1002,
+				"error_message": "Application error",
+			}}
+		}
+		return map[string]interface{}{"order": map[string]interface{}{
+			"response_status": "success",
+			"endpoint": endpoint,
+			"amount": order["amount"],
+		}}
+	})
+	defer server.Close()
+
+	type request struct {
+		OrderID		string	`json:"order_id"`
+		Amount		int64	`json:"amount"`
+	}
+	type reply struct {
+		Endpoint	string	`json:"endpoint"`
+		Amount		int64	`json:"amount"`
+	}
+
+	var header string
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			header = ex.Header.Get("X-Idempotency-Key")
+			return next(ex)
+		}
+	})
+
+	resp, err := Call[request, reply](context.Background(), a, "/new/endpoint/", request{OrderID: "1", Amount: 100}, &CallOptions{Header: http.Header{"X-Idempotency-Key": {"1"}}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if resp.Endpoint != "new/endpoint" || resp.Amount != 100 || header != "1" {
+		t.Errorf("unexpected response %+v, header %q", resp, header)
+	}
+
+	if _, err := Call[request, reply](context.Background(), a, "new/endpoint", request{OrderID: "declined"}, nil); err == nil || err.Error() != "1002: Application error" {
+		t.Errorf("expected fondy error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Call[request, map[string]interface{}](ctx, a, "new/endpoint", request{OrderID: "1"}, nil); err == nil {
+		t.Error("canceled context is ignored")
+	}
+}
+
+func TestCallList(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			ex.StatusCode, ex.Body = 200, []byte(`{"response": [{"order_id": "1"}, {"order_id": "2"}]}`)
+			return ex.Decode()
+		}
+	})
+
+	list, err := Call[map[string]string, []map[string]interface{}](context.Background(), a, "transaction_list", map[string]string{"order_id": "1"}, &CallOptions{Unsigned: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(list) != 2 || list[1]["order_id"] != "2" {
+		t.Errorf("unexpected list: %v", list)
+	}
+
+	a.Options.StrictSignature = true
+	if _, err := Call[map[string]string, []map[string]interface{}](context.Background(), a, "transaction_list", nil, &CallOptions{Unsigned: true}); err == nil {
+		t.Error("strict signature accepts unsigned list")
+	}
+}
@@ -0,0 +1,70 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// callbackOrder decodes the order of a 2.0 callback body without checking its signature.
+func callbackOrder(content []byte) (map[string]interface{}, json.RawMessage, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(content, &body); err != nil {
+		return nil, nil, err
+	}
+
+	var payload struct {
+		Order json.RawMessage `json:"order"`
+	}
+	switch data := body["data"].(type) {
+	case string:
+		if sd, err := base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, nil, &SignatureError{Err: ErrSignatureMalformed, Detail: "data is not base64: " + err.Error()}
+		} else if err := json.Unmarshal(sd, &payload); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, &SignatureError{Err: ErrSignatureMissing, Detail: "callback data is empty"}
+	}
+	return body, payload.Order, nil
+}
+
+// DecodeCallback verifies signature of a 2.0 callback body and decodes its order into obj.
+func (a *Api) DecodeCallback(content []byte, obj interface{}) error {
+	_, err := a.VerifyCallback(content, obj)
+	return err
+}
+
+// VerifyCallback is DecodeCallback that also tells which key verified the callback.
+func (a *Api) VerifyCallback(content []byte, obj interface{}) (Key, error) {
+	body, order, err := callbackOrder(content)
+	if err != nil {
+		return Key{}, err
+	}
+	key, err := a.verifyBody("callback", body)
+	if err != nil {
+		return key, err
+	}
+	if a.Options.Metrics != nil {
+		var status struct {
+			OrderStatus	string	`json:"order_status"`
+		}
+		json.Unmarshal(order, &status)
+		a.Options.Metrics.ObserveCallback(a.Options.MerchantID, status.OrderStatus)
+	}
+	return key, json.Unmarshal(order, obj)
+}
+
+// verifyBody checks the signature of a callback or redirect body and reports a failure to Options.Metrics.
+func (a *Api) verifyBody(endpoint string, body map[string]interface{}) (Key, error) {
+	key, err := a.checkSignature(body)
+	if err != nil && a.Options.Metrics != nil {
+		a.Options.Metrics.ObserveSignatureFailure(endpoint, a.Options.MerchantID)
+	}
+	return key, err
+}
+
+// ParseCallback verifies signature of a 2.0 callback body and returns its order.
+func (a *Api) ParseCallback(content []byte) (map[string]interface{}, error) {
+	var order map[string]interface{}
+	return order, a.DecodeCallback(content, &order)
+}
@@ -0,0 +1,255 @@
+// Package card validates and masks payment card data before it is sent to Fondy.
+package card
+
+import (
+	"strconv"
+	"strings"
+	"errors"
+	"time"
+	"fmt"
+)
+
+var (
+	ErrNumber	= errors.New("Card number is invalid")
+	ErrLuhn		= errors.New("Card number fails the Luhn check")
+	ErrExpiry	= errors.New("Card expiry date must be MMYY")
+	ErrExpired	= errors.New("Card is expired")
+	ErrCVV		= errors.New("Card CVV is invalid")
+)
+
+type Brand string
+
+const (
+	Unknown		Brand = ""
+	Visa		Brand = "visa"
+	Mastercard	Brand = "mastercard"
+	Maestro		Brand = "maestro"
+	Prostir		Brand = "prostir"
+	Amex		Brand = "amex"
+	Discover	Brand = "discover"
+	JCB		Brand = "jcb"
+	UnionPay	Brand = "unionpay"
+	DinersClub	Brand = "diners"
+)
+
+type brandRule struct {
+	brand		Brand
+	ranges		[][2]int	// inclusive prefix ranges of equal length
+	lengths		[]int
+	cvv		int
+}
+
+// rules are checked in order, narrower ranges come before broad ones like Maestro.
+var rules = []brandRule{
+	{Prostir, [][2]int{{9804, 9804}}, []int{16}, 3},
+	{Amex, [][2]int{{34, 34}, {37, 37}}, []int{15}, 4},
+	{DinersClub, [][2]int{{300, 305}, {36, 36}, {38, 39}}, []int{14, 15, 16, 17, 18, 19}, 3},
+	{JCB, [][2]int{{3528, 3589}}, []int{16, 17, 18, 19}, 3},
+	{Discover, [][2]int{{6011, 6011}, {644, 649}, {65, 65}}, []int{16, 17, 18, 19}, 3},
+	{UnionPay, [][2]int{{62, 62}}, []int{16, 17, 18, 19}, 3},
+	{Mastercard, [][2]int{{51, 55}, {2221, 2720}}, []int{16}, 3},
+	{Visa, [][2]int{{4, 4}}, []int{13, 16, 19}, 3},
+	{Maestro, [][2]int{{50, 50}, {56, 69}}, []int{12, 13, 14, 15, 16, 17, 18, 19}, 3},
+}
+
+func rule(number []byte) (brandRule, bool) {
+	for _, r := range rules {
+		for _, rng := range r.ranges {
+			size := len(strconv.Itoa(rng[0]))
+			if len(number) < size {
+				continue
+			}
+			prefix := 0
+			for _, c := range number[:size] {
+				prefix = prefix * 10 + int(c - '0')
+			}
+			if digits(number[:size]) && prefix >= rng[0] && prefix <= rng[1] {
+				return r, true
+			}
+		}
+	}
+	return brandRule{}, false
+}
+
+// Normalize removes spaces and dashes people type into card numbers.
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// normalize is Normalize for a buffer, it returns number itself when there is
+// nothing to remove and a copy the caller must wipe otherwise.
+func normalize(number []byte) ([]byte, bool) {
+	clean := true
+	for _, c := range number {
+		clean = clean && c != ' ' && c != '-'
+	}
+	if clean {
+		return number, false
+	}
+	output := make([]byte, 0, len(number))
+	for _, c := range number {
+		if c != ' ' && c != '-' {
+			output = append(output, c)
+		}
+	}
+	return output, true
+}
+
+func digits(s []byte) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func luhn(number []byte) bool {
+	if !digits(number) {
+		return false
+	}
+
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if (len(number) - i) % 2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum % 10 == 0
+}
+
+// Luhn reports whether the number passes the Luhn checksum.
+func Luhn(number string) bool {
+	return luhn([]byte(Normalize(number)))
+}
+
+// DetectBrand detects the card brand by BIN.
+func DetectBrand(number string) Brand {
+	if r, ok := rule([]byte(Normalize(number))); ok {
+		return r.brand
+	}
+	return Unknown
+}
+
+// CVVLength returns the CVV length of the brand, 4 for Amex and 3 otherwise.
+func CVVLength(brand Brand) int {
+	for _, r := range rules {
+		if r.brand == brand {
+			return r.cvv
+		}
+	}
+	return 3
+}
+
+// ValidateNumber checks digits, length for the brand and the Luhn checksum.
+func ValidateNumber(number string) (Brand, error) {
+	return ValidateNumberBytes([]byte(number))
+}
+
+// ValidateNumberBytes is ValidateNumber for a number held in a buffer, it
+// makes no copy of the number that outlives the call.
+func ValidateNumberBytes(number []byte) (Brand, error) {
+	number, copied := normalize(number)
+	if copied {
+		defer clear(number)
+	}
+	if !digits(number) || len(number) < 12 || len(number) > 19 {
+		return Unknown, ErrNumber
+	}
+
+	r, ok := rule(number)
+	if ok {
+		valid := false
+		for _, n := range r.lengths {
+			valid = valid || n == len(number)
+		}
+		if !valid {
+			return r.brand, fmt.Errorf("%w: %d digits for %s", ErrNumber, len(number), r.brand)
+		}
+	}
+	if !luhn(number) {
+		return r.brand, ErrLuhn
+	}
+	return r.brand, nil
+}
+
+// ValidateCVV checks the CVV length for the brand, Maestro cards may have none.
+func ValidateCVV(cvv string, brand Brand) error {
+	return ValidateCVVBytes([]byte(cvv), brand)
+}
+
+// ValidateCVVBytes is ValidateCVV for a CVV held in a buffer.
+func ValidateCVVBytes(cvv []byte, brand Brand) error {
+	if len(cvv) == 0 && brand == Maestro {
+		return nil
+	}
+	if !digits(cvv) || len(cvv) != CVVLength(brand) {
+		return ErrCVV
+	}
+	return nil
+}
+
+// Expiry is the month a card is valid through.
+type Expiry struct {
+	Month	int
+	Year	int
+}
+
+// ParseExpiry parses the MMYY format Fondy uses for expiry_date.
+func ParseExpiry(s string) (Expiry, error) {
+	if len(s) != 4 || !digits([]byte(s)) {
+		return Expiry{}, ErrExpiry
+	}
+	month, _ := strconv.Atoi(s[:2])
+	year, _ := strconv.Atoi(s[2:])
+	if month < 1 || month > 12 {
+		return Expiry{}, ErrExpiry
+	}
+	return Expiry{Month: month, Year: 2000 + year}, nil
+}
+
+// Expired reports whether the card is expired at now, it is valid through the last day of its month.
+func (e Expiry) Expired(now time.Time) bool {
+	return !now.Before(time.Date(e.Year, time.Month(e.Month) + 1, 1, 0, 0, 0, 0, now.Location()))
+}
+
+func (e Expiry) String() string {
+	return fmt.Sprintf("%02d%02d", e.Month, e.Year % 100)
+}
+
+// Validate checks card number, MMYY expiry and CVV at now and returns the brand.
+func Validate(number, expiry, cvv string, now time.Time) (Brand, error) {
+	return ValidateBytes([]byte(number), expiry, []byte(cvv), now)
+}
+
+// ValidateBytes is Validate for card data held in buffers, like fondy.SensitiveString.
+func ValidateBytes(number []byte, expiry string, cvv []byte, now time.Time) (Brand, error) {
+	brand, err := ValidateNumberBytes(number)
+	if err != nil {
+		return brand, err
+	}
+	if e, err := ParseExpiry(expiry); err != nil {
+		return brand, err
+	} else if e.Expired(now) {
+		return brand, fmt.Errorf("%w: %s", ErrExpired, e)
+	}
+	return brand, ValidateCVVBytes(cvv, brand)
+}
+
+// Mask keeps at most the first six and last four digits as PCI DSS allows,
+// e.g. 444455******1111. Numbers too short to mask safely are masked whole.
+func Mask(number string) string {
+	return MaskBytes([]byte(number))
+}
+
+// MaskBytes is Mask for a number held in a buffer, it never copies the number in clear.
+func MaskBytes(number []byte) string {
+	if len(number) < 12 {
+		return strings.Repeat("*", len(number))
+	}
+	return string(number[:6]) + strings.Repeat("*", len(number) - 10) + string(number[len(number) - 4:])
+}
@@ -0,0 +1,77 @@
+package card
+
+import (
+	"testing"
+	"errors"
+	"time"
+)
+
+func TestDetectBrand(t *testing.T) {
+	cases := map[string]Brand{
+		"4444555566661111":	Visa,
+		"5555555555554444":	Mastercard,
+		"2223003122003222":	Mastercard,
+		"6759649826438453":	Maestro,
+		"5018 0000 0000 0009":	Maestro,
+		"9804000000000000":	Prostir,
+		"378282246310005":	Amex,
+		"6011111111111117":	Discover,
+		"3530111333300000":	JCB,
+		"6200000000000005":	UnionPay,
+		"36227206271667":	DinersClub,
+		"1234567812345678":	Unknown,
+	}
+	for number, brand := range cases {
+		if got := DetectBrand(number); got != brand {
+			t.Errorf("%s: %q, expected %q", number, got, brand)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		number, expiry, cvv	string
+		err			error
+	}{
+		{"4444 5555 6666 1111", "1026", "123", nil},
+		{"378282246310005", "1230", "1234", nil},
+		{"378282246310005", "1230", "123", ErrCVV},
+		{"6759649826438453", "1230", "", nil},
+		{"4444555566661112", "1230", "123", ErrLuhn},
+		{"44445555666611", "1230", "123", ErrNumber},
+		{"4444-5555-6666-111a", "1230", "123", ErrNumber},
+		{"4444555566661111", "0926", "123", ErrExpired},
+		{"4444555566661111", "1326", "123", ErrExpiry},
+		{"4444555566661111", "10/26", "123", ErrExpiry},
+		{"4444555566661111", "1230", "", ErrCVV},
+	}
+	for _, c := range cases {
+		if _, err := Validate(c.number, c.expiry, c.cvv, now); !errors.Is(err, c.err) || (c.err == nil && err != nil) {
+			t.Errorf("%s %s %s: %v, expected %v", c.number, c.expiry, c.cvv, err, c.err)
+		}
+	}
+
+	number := []byte("4444 5555 6666 1111")
+	if brand, err := ValidateBytes(number, "1230", []byte("123"), now); err != nil || brand != Visa || string(number) != "4444 5555 6666 1111" {
+		t.Errorf("buffer is not validated as is: %v %s", err, number)
+	}
+
+	if e, _ := ParseExpiry("0730"); e.String() != "0730" || e.Year != 2030 {
+		t.Errorf("unexpected expiry %+v", e)
+	}
+}
+
+func TestMask(t *testing.T) {
+	cases := map[string]string{
+		"4444555566661111":	"444455******1111",
+		"4444555511116666123":	"444455*********6123",
+		"12345":		"*****",
+	}
+	for number, masked := range cases {
+		if got := Mask(number); got != masked {
+			t.Errorf("%s: %s, expected %s", number, got, masked)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package fondy
+
+import (
+	"github.com/srostyslav/fondy/card"
+	"errors"
+	"time"
+)
+
+// Validate checks card number, expiry_date and cvv2 before the card is charged.
+func (d *PCIDSSOneStep) Validate() error {
+	_, err := card.ValidateBytes(d.CardNumber.b, d.ExpiryDate, d.Cvv2.b, time.Now())
+	return err
+}
+
+// Validate checks the receiver card number, a rectoken is taken as is.
+func (d *P2Pcredit) Validate() error {
+	if d.ReceiverCardNumber.IsZero() {
+		if d.ReceiverRectoken == "" {
+			return errors.New("Receiver card number or rectoken is required")
+		}
+		return nil
+	}
+	_, err := card.ValidateNumberBytes(d.ReceiverCardNumber.b)
+	return err
+}
@@ -0,0 +1,35 @@
+package fondy
+
+import (
+	"github.com/srostyslav/fondy/card"
+	"testing"
+	"errors"
+)
+
+func TestCardValidation(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	calls := 0
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			calls++
+			return nil
+		}
+	})
+
+	if _, err := a.PcidssStep1(&PCIDSSOneStep{OrderID: "1", CardNumber: Sensitive("4444555566661112"), ExpiryDate: "1230", Cvv2: Sensitive("123")}); !errors.Is(err, card.ErrLuhn) {
+		t.Errorf("expected luhn error, got %v", err)
+	}
+	if _, err := a.PcidssStep1(&PCIDSSOneStep{OrderID: "1", CardNumber: Sensitive("4444555566661111"), ExpiryDate: "0120", Cvv2: Sensitive("123")}); !errors.Is(err, card.ErrExpired) {
+		t.Errorf("expected expired error, got %v", err)
+	}
+	if _, err := a.P2Pcredit(&P2Pcredit{OrderID: "1", ReceiverCardNumber: Sensitive("44445555")}); !errors.Is(err, card.ErrNumber) {
+		t.Errorf("expected number error, got %v", err)
+	}
+	if calls != 0 {
+		t.Error("invalid card is sent to fondy")
+	}
+
+	if _, err := a.P2Pcredit(&P2Pcredit{OrderID: "1", ReceiverRectoken: "token"}); err != nil || calls != 1 {
+		t.Errorf("rectoken payout is rejected: %v", err)
+	}
+}
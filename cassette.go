@@ -0,0 +1,266 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"reflect"
+	"errors"
+	"sort"
+	"sync"
+	"fmt"
+)
+
+var ErrCassetteUnmatched = errors.New("No recorded interaction matches the request")
+
+type CassetteMode int
+
+const (
+	CassetteReplay CassetteMode = iota
+	CassetteRecord
+)
+
+// Interaction is a recorded call with secrets, card data and signatures scrubbed.
+type Interaction struct {
+	Endpoint				string 			`json:"endpoint"`
+	Order					map[string]interface{}	`json:"order"`
+	Status					int 			`json:"status"`
+	Signed					bool 			`json:"signed"`	// response data is re-signed on replay
+	Response				interface{}		`json:"response"`	// decoded response data
+}
+
+// Cassette is an http.RoundTripper that records Fondy calls to Path and replays
+// them offline. Set it as ApiOptions.Transport, with the api SecretKey set to
+// Key when replaying.
+type Cassette struct {
+	Path		string
+	Mode		CassetteMode
+	Key		string			// signs replayed responses, "test" by default
+	Secrets		[]string		// scrubbed from recordings, e.g. the real secret key
+	Ignore		[]string		// order fields not matched, e.g. generated order ids
+	Transport	http.RoundTripper	// used when recording, http.DefaultTransport when nil
+
+	mu		sync.Mutex
+	interactions	[]Interaction
+	used		[]bool
+	unmatched	[]string
+}
+
+// NewCassette loads the recorded interactions of path in replay mode.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{Path: path, Mode: mode, Key: "test"}
+	if mode == CassetteRecord {
+		return c, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &c.interactions); err != nil {
+		return nil, errors.New(fmt.Sprintf("Cassette %s: %s", path, err))
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+func (c *Cassette) scrub(payload map[string]interface{}) map[string]interface{} {
+	output := Redact(payload, c.Secrets...)
+	delete(output, "signature")
+	return output
+}
+
+// requestOrder decodes the order of a request envelope.
+func (c *Cassette) requestOrder(body []byte) (map[string]interface{}, error) {
+	var envelope struct {
+		Request map[string]interface{} `json:"request"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+
+	data, ok := envelope.Request["data"].(string)
+	if !ok {
+		delete(envelope.Request, "version")
+		return c.scrub(envelope.Request), nil
+	}
+
+	var payload struct {
+		Order map[string]interface{} `json:"order"`
+	}
+	if raw, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, err
+	}
+	return c.scrub(payload.Order), nil
+}
+
+func (c *Cassette) matches(endpoint string, order map[string]interface{}, i Interaction) bool {
+	if i.Endpoint != endpoint {
+		return false
+	}
+	// Redact of a scrubbed order is a copy
+	want, got := Redact(i.Order), Redact(order)
+	for _, field := range c.Ignore {
+		delete(want, field)
+		delete(got, field)
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		content, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = content
+	}
+
+	endpoint := strings.Trim(req.URL.Path, "/")
+	if i := strings.Index(endpoint, "api/"); i >= 0 {
+		endpoint = endpoint[i + len("api/"):]
+	}
+	order, err := c.requestOrder(body)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Cassette cannot decode %s request: %s", endpoint, err))
+	}
+
+	if c.Mode == CassetteRecord {
+		return c.record(req, body, endpoint, order)
+	}
+	return c.replay(req, endpoint, order)
+}
+
+func (c *Cassette) record(req *http.Request, body []byte, endpoint string, order map[string]interface{}) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(string(content)))
+
+	interaction := Interaction{Endpoint: endpoint, Order: order, Status: resp.StatusCode}
+	var data struct {
+		Response interface{} `json:"response"`
+	}
+	if json.Unmarshal(content, &data) == nil {
+		interaction.Response = redactValue(data.Response, c.Secrets...)
+	}
+	if response, ok := data.Response.(map[string]interface{}); ok {
+		if encoded, ok := response["data"].(string); ok {
+			var decoded interface{}
+			if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil && json.Unmarshal(raw, &decoded) == nil {
+				interaction.Response, interaction.Signed = redactValue(decoded, c.Secrets...), true
+			}
+		} else {
+			interaction.Response = c.scrub(response)
+		}
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.used = append(c.used, true)
+	c.mu.Unlock()
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, endpoint string, order map[string]interface{}) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for n, i := range c.interactions {
+		if c.used[n] || !c.matches(endpoint, order, i) {
+			continue
+		}
+		c.used[n] = true
+
+		response := i.Response
+		if i.Signed {
+			raw, err := json.Marshal(i.Response)
+			if err != nil {
+				return nil, err
+			}
+			data := base64.StdEncoding.EncodeToString(raw)
+			response = map[string]interface{}{"data": data, "signature": signature(c.key(), data)}
+		}
+		content, err := json.Marshal(map[string]interface{}{"response": response})
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			Status: fmt.Sprintf("%d %s", i.Status, http.StatusText(i.Status)),
+			StatusCode: i.Status,
+			Proto: "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body: ioutil.NopCloser(strings.NewReader(string(content))),
+			ContentLength: int64(len(content)),
+			Request: req,
+		}, nil
+	}
+
+	detail, _ := json.Marshal(order)
+	c.unmatched = append(c.unmatched, endpoint + " " + string(detail))
+	return nil, fmt.Errorf("%w in %s: %s %s", ErrCassetteUnmatched, c.Path, endpoint, detail)
+}
+
+func (c *Cassette) key() string {
+	if c.Key == "" {
+		return "test"
+	}
+	return c.Key
+}
+
+// Save writes the recorded interactions to Path.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Mode != CassetteRecord {
+		return nil
+	}
+	content, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.Path, append(content, '\n'), 0644)
+}
+
+// Check reports calls that had no recorded interaction and interactions never replayed.
+func (c *Cassette) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var problems []string
+	for _, call := range c.unmatched {
+		problems = append(problems, "unmatched call " + call)
+	}
+	for n, i := range c.interactions {
+		if !c.used[n] {
+			problems = append(problems, "unused interaction " + i.Endpoint + " " + toString(i.Order["order_id"]))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return errors.New(fmt.Sprintf("Cassette %s:\n%s", c.Path, strings.Join(problems, "\n")))
+}
@@ -0,0 +1,69 @@
+package fondy
+
+import (
+	"path/filepath"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"errors"
+)
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkout.json")
+
+	live := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "live-secret"})
+	server := fakeFondy(t, live, func(endpoint string, order map[string]interface{}) interface{} {
+		return map[string]interface{}{"order": map[string]interface{}{
+			"response_status": "success",
+			"order_status": "approved",
+			"masked_card": order["card_number"],
+		}}
+	})
+	defer server.Close()
+
+	recorder, _ := NewCassette(path, CassetteRecord)
+	recorder.Secrets = []string{"live-secret"}
+	live.Options.Transport = recorder
+
+	order := &PCIDSSOneStep{OrderID: "1", OrderDesc: "test", Currency: "UAH", Amount: "100", CardNumber: Sensitive("4444555566661111"), Cvv2: Sensitive("123"), ExpiryDate: "1230"}
+	recorded, err := live.PcidssStep1(order)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	content, _ := ioutil.ReadFile(path)
+	for _, leak := range []string{"4444555566661111", "live-secret", "1230", `"signature"`} {
+		if strings.Contains(string(content), leak) {
+			t.Errorf("cassette leaks %s: %s", leak, content)
+		}
+	}
+
+	player, err := NewCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test", Transport: player})
+	a.ApiUrl = "http://fondy.invalid/api"
+
+	replayed, err := a.PcidssStep1(order)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	got, want := replayed["order"].(map[string]interface{}), recorded["order"].(map[string]interface{})
+	if got["order_status"] != want["order_status"] || got["masked_card"] != "444455******1111" {
+		t.Errorf("unexpected replay: %v", replayed)
+	}
+	if err := player.Check(); err != nil {
+		t.Error(err.Error())
+	}
+
+	if _, err := a.PcidssStep1(order); !errors.Is(err, ErrCassetteUnmatched) {
+		t.Errorf("expected unmatched error, got %v", err)
+	}
+	if err := player.Check(); err == nil || !strings.Contains(err.Error(), "unmatched call 3dsecure_step1") {
+		t.Errorf("unmatched call is not reported: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxResponseSize limits response bodies when ApiOptions.MaxResponseSize is 0.
+const DefaultMaxResponseSize = 10 << 20
+
+var ErrResponseTooLarge = errors.New("Response body is too large")
+
+// ResponseError keeps the raw body of a response that could not be used.
+type ResponseError struct {
+	StatusCode	int
+	Body		[]byte		// raw body, cut at the size limit
+	Err		error		// nil for an unexpected status code
+}
+
+func (e *ResponseError) Error() string {
+	content := e.Body
+	if len(content) > 512 {
+		content = content[:512]
+	}
+	if e.Err == nil {
+		return fmt.Sprintf("Response code is: %d; content: %s", e.StatusCode, string(content))
+	}
+	return fmt.Sprintf("%s; content: %s", e.Err, string(content))
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+func (a *Api) maxResponseSize() int64 {
+	if a.Options.MaxResponseSize == 0 {
+		return DefaultMaxResponseSize
+	}
+	return a.Options.MaxResponseSize
+}
+
+// readBody reads at most limit bytes, a negative limit reads everything.
+func readBody(r io.Reader, limit int64) ([]byte, error) {
+	if limit < 0 {
+		return io.ReadAll(r)
+	}
+	content, err := io.ReadAll(io.LimitReader(r, limit + 1))
+	if err != nil {
+		return content, err
+	}
+	if int64(len(content)) > limit {
+		return content[:limit], fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, limit)
+	}
+	return content, nil
+}
+
+func isDecodeError(err error) bool {
+	var (
+		syntax		*json.SyntaxError
+		typ		*json.UnmarshalTypeError
+		corrupt		base64.CorruptInputError
+	)
+	return errors.As(err, &syntax) || errors.As(err, &typ) || errors.As(err, &corrupt) || errors.Is(err, io.ErrUnexpectedEOF)
+}
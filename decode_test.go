@@ -0,0 +1,188 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"encoding/base64"
+	"encoding/json"
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"errors"
+	"time"
+)
+
+// cannedList is a list response of n transactions as Fondy returns it.
+func cannedList(n int) []byte {
+	list := make([]map[string]interface{}, n)
+	for i := range list {
+		list[i] = map[string]interface{}{
+			"order_id": strconv.Itoa(i),
+			"payment_id": 100000 + i,
+			"amount": "12500",
+			"currency": "UAH",
+			"tran_type": "purchase",
+			"transaction_status": "approved",
+			"masked_card": "444455XXXXXX1111",
+			"order_time": "21.10.2026 12:00:00",
+		}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"response": list})
+	return body
+}
+
+func cannedApi(body []byte) *Api {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			ex.StatusCode, ex.Body = 200, body
+			return ex.Decode()
+		}
+	})
+	return a
+}
+
+func BenchmarkTransactionList(b *testing.B) {
+	a := cannedApi(cannedList(200))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if list, err := a.TransactionList("1"); err != nil || len(list) != 200 {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetReports(b *testing.B) {
+	a := cannedApi(cannedList(200))
+	from := time.Now().Add(-time.Hour)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if list, err := a.GetReports(from, time.Now()); err != nil || len(list) != 200 {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestResponseLimits(t *testing.T) {
+	body := cannedList(50)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test", MaxResponseSize: 100})
+	a.ApiUrl = server.URL
+
+	_, err := a.TransactionList("1")
+	var resp *ResponseError
+	if !errors.As(err, &resp) || !errors.Is(err, ErrResponseTooLarge) || len(resp.Body) != 100 {
+		t.Fatalf("expected too large error, got %v", err)
+	}
+
+	a.Options.MaxResponseSize = -1
+	if list, err := a.TransactionList("1"); err != nil || len(list) != 50 {
+		t.Errorf("unlimited response is not read: %v", err)
+	}
+}
+
+func TestResponseDecodeError(t *testing.T) {
+	a := cannedApi([]byte(`{"response": {"data": "not base64!", "signature": "x"}}`))
+	if _, err := a.GetReports(time.Now(), time.Now()); err == nil {
+		t.Fatal("corrupt data is accepted")
+	} else {
+		var resp *ResponseError
+		if !errors.As(err, &resp) || !strings.Contains(string(resp.Body), "not base64!") {
+			t.Errorf("raw body is not kept: %v", err)
+		}
+	}
+
+	a = cannedApi([]byte(`{"response": [{"order_id": 1}]`))
+	var resp *ResponseError
+	if _, err := a.TransactionList("1"); !errors.As(err, &resp) || resp.StatusCode != 200 {
+		t.Errorf("expected response error, got %v", err)
+	}
+
+	a = cannedApi(cannedList(3))
+	list, err := Call[map[string]string, []struct {
+		OrderID		string	`json:"order_id"`
+		PaymentID	int64	`json:"payment_id"`
+	}](a.context(), a, "transaction_list", nil, &CallOptions{Unsigned: true})
+	if err != nil || len(list) != 3 || list[2].PaymentID != 100002 {
+		t.Errorf("typed list is not decoded: %v %v", list, err)
+	}
+}
+
+// legacyDecode is the decoder before the in place one, kept as the benchmark baseline:
+// it parsed the envelope into a RawMessage and parsed that again, and Result did it all
+// over for every middleware asking for the status.
+func legacyDecode(content []byte, obj interface{}) error {
+	var envelope struct {
+		Response	json.RawMessage	`json:"response"`
+	}
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return err
+	}
+
+	switch raw := bytes.TrimSpace(envelope.Response); {
+	case len(raw) > 0 && raw[0] == '{':
+		var response struct {
+			Data		*string		`json:"data"`
+			Signature	*string		`json:"signature"`
+			ErrorCode	interface{}	`json:"error_code"`
+			ErrorMessage	*string		`json:"error_message"`
+		}
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return err
+		}
+		if response.Data != nil {
+			decoder := json.NewDecoder(base64.NewDecoder(base64.StdEncoding, strings.NewReader(*response.Data)))
+			return decoder.Decode(&obj)
+		}
+		return json.Unmarshal(raw, &obj)
+	case len(raw) > 0 && raw[0] == '[':
+		return json.Unmarshal(raw, &obj)
+	}
+	return errors.New("Response body is empty")
+}
+
+// BenchmarkDecode decodes a response and reads its status three times, as the logging,
+// metrics and tracing middleware do.
+func BenchmarkDecode(b *testing.B) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	data, _ := a.ToB64(map[string]interface{}{"order": map[string]interface{}{"order_id": "1", "order_status": "approved", "amount": "12500", "currency": "UAH"}})
+	signed, _ := json.Marshal(map[string]interface{}{"response": map[string]interface{}{"data": data, "signature": a.GetSignature(data)}})
+
+	for _, body := range []struct {
+		name	string
+		content	[]byte
+	}{{"list", cannedList(200)}, {"data", signed}} {
+		b.Run(body.name + "/legacy", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var obj interface{}
+				if err := legacyDecode(body.content, &obj); err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 3; j++ {
+					var status responseStatus
+					legacyDecode(body.content, &status)
+					status.result()
+				}
+			}
+		})
+		b.Run(body.name + "/inplace", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var obj interface{}
+				ex := &Exchange{StatusCode: 200, Body: body.content, api: a, target: &obj}
+				if err := ex.Decode(); err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 3; j++ {
+					ex.Result()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"html/template"
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	CheckoutScriptURL	= "https://pay.fondy.eu/latest/checkout-vue/checkout.js"
+	CheckoutStyleURL	= "https://pay.fondy.eu/latest/checkout-vue/checkout.css"
+
+	// DefaultPolicy is the Content-Security-Policy sent by CheckoutHandler, %s is the nonce.
+	DefaultPolicy		= "default-src 'self'; script-src 'nonce-%s' https://pay.fondy.eu; style-src 'self' https://pay.fondy.eu; frame-src https://pay.fondy.eu; connect-src https://pay.fondy.eu; img-src 'self' data: https://pay.fondy.eu"
+)
+
+// Embed renders the embedded checkout for a token from CheckoutToken.
+type Embed struct {
+	Token			string
+	Container		string			// element id, "fondy-checkout" by default
+	Lang			string
+	DesignID		int64
+	PaymentSystems		[]string		// payment methods shown, all when empty
+	Options			map[string]interface{}	// extra options of the checkout script
+	Nonce			string			// CSP nonce of the script tags
+	Title			string			// title of the full page
+	ScriptURL		string			// CheckoutScriptURL by default
+	StyleURL		string			// CheckoutStyleURL by default
+}
+
+// NewEmbed takes language, design and payment systems from the checkout params.
+func NewEmbed(token string, data *Checkout) *Embed {
+	e := &Embed{Token: token}
+	if data != nil {
+		e.Lang, e.DesignID = data.Lang, data.DesignID
+		for _, system := range strings.Split(data.PaymentSystems, ",") {
+			if system = strings.TrimSpace(system); system != "" {
+				e.PaymentSystems = append(e.PaymentSystems, system)
+			}
+		}
+	}
+	return e
+}
+
+// EmbedCheckout creates a checkout token and the Embed to render it.
+func (a *Api) EmbedCheckout(data *Checkout) (*Embed, error) {
+	token, err := a.CheckoutToken(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewEmbed(token, data), nil
+}
+
+// config is passed to the checkout script, html/template encodes it for the script context.
+func (e *Embed) config() map[string]interface{} {
+	options := map[string]interface{}{}
+	if len(e.PaymentSystems) > 0 {
+		options["methods"] = e.PaymentSystems
+	}
+	if e.Lang != "" {
+		options["locales"] = []string{e.Lang}
+	}
+	for k, v := range e.Options {
+		options[k] = v
+	}
+
+	params := map[string]interface{}{"token": e.Token}
+	if e.Lang != "" {
+		params["lang"] = e.Lang
+	}
+	if e.DesignID != 0 {
+		params["design_id"] = e.DesignID
+	}
+	return map[string]interface{}{"options": options, "params": params}
+}
+
+type embedView struct {
+	*Embed
+	Config		map[string]interface{}
+	Selector	string
+}
+
+func (e *Embed) view() embedView {
+	v := embedView{Embed: e, Config: e.config()}
+	if v.Container == "" {
+		v.Container = "fondy-checkout"
+	}
+	if v.ScriptURL == "" {
+		v.ScriptURL = CheckoutScriptURL
+	}
+	if v.StyleURL == "" {
+		v.StyleURL = CheckoutStyleURL
+	}
+	if v.Title == "" {
+		v.Title = "Payment"
+	}
+	v.Selector = "#" + v.Container
+	return v
+}
+
+var embedTemplates = template.Must(template.New("snippet").Parse(`<link rel="stylesheet" href="{{.StyleURL}}">
+<div id="{{.Container}}"></div>
+<script src="{{.ScriptURL}}"{{with .Nonce}} nonce="{{.}}"{{end}}></script>
+<script{{with .Nonce}} nonce="{{.}}"{{end}}>fondy({{.Selector}}, {{.Config}});</script>
+`))
+
+var _ = template.Must(embedTemplates.New("page").Parse(`<!DOCTYPE html>
+<html{{with .Lang}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+</head>
+<body>
+{{template "snippet" .}}</body>
+</html>
+`))
+
+// Snippet renders the container and scripts to include in a page.
+func (e *Embed) Snippet() (template.HTML, error) {
+	var b bytes.Buffer
+	if err := embedTemplates.ExecuteTemplate(&b, "snippet", e.view()); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// Render writes a full payment page.
+func (e *Embed) Render(w io.Writer) error {
+	return embedTemplates.ExecuteTemplate(w, "page", e.view())
+}
+
+// Nonce returns a random CSP nonce, url safe so html/template does not escape it.
+func Nonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CheckoutHandler creates a checkout token per request and serves the payment page.
+type CheckoutHandler struct {
+	Api		*Api
+	Checkout	func(r *http.Request) (*Checkout, error)	// checkout params of the request
+	Page		Embed						// container, title and urls of the page
+	Nonce		func(r *http.Request) string			// nonce of a CSP set by the app, the handler sets DefaultPolicy when nil
+}
+
+func (h *CheckoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := h.Checkout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Api.WithContext(r.Context()).CheckoutToken(data)
+	if err != nil {
+		http.Error(w, "Payment is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	page := NewEmbed(token, data)
+	page.Container, page.Title, page.Options = h.Page.Container, h.Page.Title, h.Page.Options
+	page.ScriptURL, page.StyleURL = h.Page.ScriptURL, h.Page.StyleURL
+	if h.Nonce != nil {
+		page.Nonce = h.Nonce(r)
+	} else {
+		page.Nonce = Nonce()
+		w.Header().Set("Content-Security-Policy", fmt.Sprintf(DefaultPolicy, page.Nonce))
+	}
+
+	var b bytes.Buffer
+	if err := page.Render(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,78 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"net/http"
+	"strings"
+	"testing"
+	"errors"
+)
+
+func TestEmbedSnippet(t *testing.T) {
+	e := NewEmbed(`abc"</script><script>alert(1)</script>`, &Checkout{Lang: "uk", DesignID: 42, PaymentSystems: "card, banklinks_eu"})
+	e.Nonce = "n0nce"
+
+	snippet, err := e.Snippet()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s := string(snippet)
+	for _, want := range []string{
+		`<div id="fondy-checkout"></div>`,
+		`<script src="` + CheckoutScriptURL + `" nonce="n0nce"></script>`,
+		`<script nonce="n0nce">fondy("#fondy-checkout", `,
+		`"methods":["card","banklinks_eu"]`,
+		`"design_id":42`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("snippet has no %s: %s", want, s)
+		}
+	}
+	if strings.Contains(s, "<script>alert") {
+		t.Errorf("token is not escaped: %s", s)
+	}
+}
+
+func TestCheckoutHandler(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		return map[string]interface{}{"response_status": "success", "token": "tok-" + order["order_id"].(string)}
+	})
+	defer server.Close()
+
+	h := &CheckoutHandler{
+		Api: a,
+		Checkout: func(r *http.Request) (*Checkout, error) {
+			id := r.URL.Query().Get("order")
+			if id == "" {
+				return nil, errors.New("order is required")
+			}
+			return &Checkout{OrderID: id, Amount: 100, Currency: "UAH", Lang: "en"}, nil
+		},
+		Page: Embed{Title: "Order <1>"},
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/pay?order=1", nil))
+	body := w.Body.String()
+	if w.Code != 200 || !strings.Contains(body, `"token":"tok-1"`) || !strings.Contains(body, "<title>Order &lt;1&gt;</title>") || !strings.Contains(body, `<html lang="en">`) {
+		t.Errorf("unexpected page %d: %s", w.Code, body)
+	}
+	csp := w.Header().Get("Content-Security-Policy")
+	if i := strings.Index(csp, "'nonce-"); i < 0 || !strings.Contains(body, `nonce="` + strings.SplitN(csp[i + 7:], "'", 2)[0] + `"`) {
+		t.Errorf("csp nonce is not used: %s", csp)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/pay", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status %d", w.Code)
+	}
+
+	h.Nonce = func(r *http.Request) string { return "app" }
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/pay?order=2", nil))
+	if w.Header().Get("Content-Security-Policy") != "" || !strings.Contains(w.Body.String(), `nonce="app"`) {
+		t.Errorf("app nonce is not used: %s", w.Body.String())
+	}
+}
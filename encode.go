@@ -0,0 +1,225 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding"
+	"encoding/json"
+	"encoding/hex"
+	"crypto/sha1"
+	"reflect"
+	"strings"
+	"bytes"
+	"sync"
+	"io"
+)
+
+// maxPooledBuffer keeps unusually large requests from pinning memory in the pool.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer zeroes the buffer, requests carry card data.
+func putBuffer(buf *bytes.Buffer) {
+	clear(buf.Bytes())
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// marshalTo writes v as json.Marshal does, without the trailing newline of an Encoder.
+func marshalTo(buf *bytes.Buffer, v interface{}) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// writeEnvelope builds the signed request in one pass: the order is encoded into
+// a scratch buffer and streamed through base64 into both buf and the signature hash.
+func (a *Api) writeEnvelope(buf *bytes.Buffer, data map[string]interface{}) error {
+	key, err := a.signingKey()
+	if err != nil {
+		return err
+	}
+
+	order := getBuffer()
+	defer putBuffer(order)
+
+	order.WriteString(`{"order":`)
+	if err := marshalTo(order, revealOrder(data)); err != nil {
+		return err
+	}
+	order.WriteByte('}')
+
+	h := sha1.New()
+	io.WriteString(h, key.Secret)
+	io.WriteString(h, "|")
+
+	buf.Grow(base64.StdEncoding.EncodedLen(order.Len()) + 128)
+	buf.WriteString(`{"request":{"data":"`)
+	b64 := base64.NewEncoder(base64.StdEncoding, io.MultiWriter(buf, h))
+	b64.Write(order.Bytes())
+	b64.Close()
+
+	var sum [sha1.Size]byte
+	var sign [sha1.Size * 2]byte
+	hex.Encode(sign[:], h.Sum(sum[:0]))
+
+	buf.WriteString(`","signature":"`)
+	buf.Write(sign[:])
+	buf.WriteString(`","version":`)
+	if err := marshalTo(buf, a.Options.ApiProtocol); err != nil {
+		return err
+	}
+	buf.WriteString("}}")
+	return nil
+}
+
+// pooledBody is a request body that returns its buffer to the pool once the
+// http transport closes it.
+type pooledBody struct {
+	*bytes.Reader
+	buf	*bytes.Buffer
+	once	sync.Once
+}
+
+func newPooledBody(buf *bytes.Buffer) *pooledBody {
+	return &pooledBody{Reader: bytes.NewReader(buf.Bytes()), buf: buf}
+}
+
+func (b *pooledBody) Close() error {
+	b.once.Do(func() { putBuffer(b.buf) })
+	return nil
+}
+
+type orderField struct {
+	name		string
+	index		int
+	omitEmpty	bool
+}
+
+var (
+	orderFields	sync.Map	// reflect.Type to []orderField, nil when the type needs encoding/json
+	marshalerType	= reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType	= reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// marshals tells whether encoding/json calls a marshaler of t instead of encoding its kind.
+func marshals(t reflect.Type) bool {
+	return t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) || t.Implements(textType) || reflect.PointerTo(t).Implements(textType)
+}
+
+func structFields(t reflect.Type) []orderField {
+	if cached, ok := orderFields.Load(t); ok {
+		return cached.([]orderField)
+	}
+
+	var fields []orderField
+	if !marshals(t) {
+		fields = []orderField{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if f.Anonymous || strings.Contains(tag, ",string") || (f.Type != sensitiveType && marshals(f.Type)) {
+				fields = nil
+				break
+			}
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			fields = append(fields, orderField{name: name, index: i, omitEmpty: strings.Contains(","+options+",", ",omitempty,")})
+		}
+	}
+	orderFields.Store(t, fields)
+	return fields
+}
+
+// structOrder converts a request model to the order map with the values
+// encoding/json would decode, without a marshal and unmarshal round trip.
+// Nested objects still go through encoding/json so middleware sees plain maps,
+// except base64 encoded fields which are marshaled once by orderData.
+func structOrder(body interface{}) (map[string]interface{}, bool, error) {
+	v := reflect.ValueOf(body)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false, nil
+	}
+	fields := structFields(v.Type())
+	if fields == nil {
+		return nil, false, nil
+	}
+
+	data := make(map[string]interface{}, len(fields) + 1)
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+
+		if fv.Type() == sensitiveType {
+			data[f.name] = fv.Interface()
+			continue
+		}
+
+		switch fv.Kind() {
+		case reflect.String:
+			data[f.name] = fv.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			data[f.name] = float64(fv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			data[f.name] = float64(fv.Uint())
+		case reflect.Float32, reflect.Float64:
+			data[f.name] = fv.Float()
+		case reflect.Bool:
+			data[f.name] = fv.Bool()
+		default:
+			if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map || fv.Kind() == reflect.Interface) && fv.IsNil() {
+				data[f.name] = nil
+			} else if f.name == "reservation_data" || f.name == "receipt_data" {
+				data[f.name] = fv.Interface()
+			} else {
+				value, err := plainValue(fv.Interface())
+				if err != nil {
+					return nil, true, err
+				}
+				data[f.name] = value
+			}
+		}
+	}
+	return data, true, nil
+}
+
+// isEmpty is the omitempty rule of encoding/json, which never omits a struct.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+func plainValue(v interface{}) (interface{}, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := marshalTo(buf, v); err != nil {
+		return nil, err
+	}
+	var value interface{}
+	return value, json.Unmarshal(buf.Bytes(), &value)
+}
@@ -0,0 +1,138 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func benchmarkModels() map[string]interface{} {
+	return map[string]interface{}{
+		"Checkout": &Checkout{
+			OrderID: "9b6a3d1c-8f2e-4c1a-b5d7-3e9f0a2c4b6d",
+			OrderDesc: "Pay for order",
+			Amount: 12500,
+			Currency: "UAH",
+			ResponseUrl: "https://example.com/return",
+			ServerCallbackUrl: "https://example.com/callback",
+			Lang: "uk",
+			ReservationData: &ReservationData{CustomerZip: "01001", CustomerCountry: "UA", Account: "42", Products: []ReservationProduct{{ID: "1", Name: "Book", Price: 125, Quantity: 1}}},
+		},
+		"PCIDSSOneStep": &PCIDSSOneStep{OrderID: "1", OrderDesc: "Pay for order", Amount: "12500", Currency: "UAH", CardNumber: Sensitive("4444555566661111"), Cvv2: Sensitive("123"), ExpiryDate: "1230", ClientIP: "127.0.0.1"},
+		"PCIDSSTwoStep": &PCIDSSTwoStep{OrderID: "1", Pareq: "eJxVUttygjAQ", Md: "2a1f"},
+		"P2Pcredit": &P2Pcredit{OrderID: "1", OrderDesc: "Payout", Amount: "12500", Currency: "UAH", ReceiverCardNumber: Sensitive("4444555566661111")},
+		"RecurringBody": &RecurringBody{OrderID: "1", OrderDesc: "Subscription", Amount: "12500", Currency: "UAH", Rectoken: "0b5a1f0c"},
+		"Settlement": &Settlement{OrderID: "1", OperationID: "2", Currency: "UAH", Amount: "12500", OrderType: "settlement", Receiver: []Receiver{{Type: "merchant", Requisites: &Requisites{Amount: 12500, MerchantID: 600001}}}},
+		"Capture": &Capture{OrderID: "1", Amount: "12500", Currency: "UAH"},
+		"Reverse": &Reverse{OrderID: "1", Amount: "12500", Currency: "UAH", Comment: "refund"},
+		"Status": map[string]interface{}{"order_id": "1"},
+	}
+}
+
+type markedString string
+
+func (s markedString) MarshalJSON() ([]byte, error) {
+	return json.Marshal("X" + string(s))
+}
+
+type textKey int
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte("key-" + strconv.Itoa(int(k))), nil
+}
+
+// marshalerModel has fields encoding/json does not encode by their kind.
+type marshalerModel struct {
+	OrderID		string		`json:"order_id"`
+	Name		markedString	`json:"name"`
+	Key		textKey		`json:"key"`
+	When		time.Time	`json:"when,omitempty"`
+}
+
+type structModel struct {
+	OrderID		string		`json:"order_id"`
+	Empty		struct {
+		Count	int	`json:"count"`
+	}				`json:"empty,omitempty"`
+}
+
+func BenchmarkPrepereData(b *testing.B) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	for name, model := range benchmarkModels() {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := a.prepereData(model); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderDataMatchesJSON(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	models := benchmarkModels()
+	models["marshaler"] = &marshalerModel{OrderID: "1", Name: "a", Key: 7}
+	models["struct"] = &structModel{OrderID: "1"}
+	for name, model := range models {
+		data, err := a.orderData(model)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		var expected map[string]interface{}
+		output, _ := json.Marshal(model)
+		json.Unmarshal(output, &expected)
+		expected["merchant_id"] = float64(a.Options.MerchantID)
+		for k, v := range data {
+			if s, ok := v.(SensitiveString); ok {
+				if expected[k] != redacted {
+					t.Errorf("%s: %s is marshaled in clear", name, k)
+				}
+				expected[k] = s.Reveal()
+			}
+		}
+
+		envelope, err := a.envelope(data)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var body struct {
+			Request struct {
+				Data		string	`json:"data"`
+				Signature	string	`json:"signature"`
+				Version		string	`json:"version"`
+			} `json:"request"`
+		}
+		if err := json.Unmarshal(envelope, &body); err != nil {
+			t.Fatalf("%s: %s: %s", name, err, envelope)
+		}
+		if body.Request.Signature != a.GetSignature(body.Request.Data) || body.Request.Version != "2.0" {
+			t.Errorf("%s: envelope is not signed: %s", name, envelope)
+		}
+
+		var payload struct {
+			Order map[string]interface{} `json:"order"`
+		}
+		raw, _ := base64.StdEncoding.DecodeString(body.Request.Data)
+		json.Unmarshal(raw, &payload)
+
+		if v, ok := expected["reservation_data"]; ok {
+			var decoded interface{}
+			raw, _ := base64.StdEncoding.DecodeString(payload.Order["reservation_data"].(string))
+			json.Unmarshal(raw, &decoded)
+			if !reflect.DeepEqual(decoded, v) {
+				t.Errorf("%s: reservation_data %v, expected %v", name, decoded, v)
+			}
+			delete(expected, "reservation_data")
+			delete(payload.Order, "reservation_data")
+		}
+		if !reflect.DeepEqual(payload.Order, expected) {
+			t.Errorf("%s: order %v, expected %v", name, payload.Order, expected)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package fondyotel adapts an OpenTelemetry tracer to the fondy.Tracer interface.
+package fondyotel
+
+import (
+	"github.com/srostyslav/fondy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"context"
+	"sync"
+	"fmt"
+)
+
+// MaxOrders bounds how many order ids are remembered for linking callback spans.
+var MaxOrders = 10000
+
+type Tracer struct {
+	tracer		trace.Tracer
+	propagator	propagation.TextMapPropagator
+
+	mu		sync.Mutex
+	orders		map[string]trace.SpanContext
+	queue		[]string
+}
+
+// NewTracer wraps tracer, the global propagator is used when propagator is nil.
+func NewTracer(tracer trace.Tracer, propagator propagation.TextMapPropagator) *Tracer {
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	return &Tracer{tracer: tracer, propagator: propagator, orders: map[string]trace.SpanContext{}}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, fondy.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, &Span{span: span, tracer: t}
+}
+
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+func (t *Tracer) StartLinked(ctx context.Context, name string, orderID string) (context.Context, fondy.Span) {
+	options := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindServer)}
+
+	t.mu.Lock()
+	if sc, ok := t.orders[orderID]; ok {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: sc}))
+	}
+	t.mu.Unlock()
+
+	ctx, span := t.tracer.Start(ctx, name, options...)
+	return ctx, &Span{span: span}
+}
+
+func (t *Tracer) remember(orderID string, sc trace.SpanContext) {
+	if orderID == "" || !sc.IsValid() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.orders[orderID]; !ok {
+		t.queue = append(t.queue, orderID)
+	}
+	t.orders[orderID] = sc
+
+	for len(t.queue) > MaxOrders {
+		delete(t.orders, t.queue[0])
+		t.queue = t.queue[1:]
+	}
+}
+
+type Span struct {
+	span		trace.Span
+	tracer		*Tracer
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(attr(key, value))
+	if key == "fondy.order_id" && s.tracer != nil {
+		s.tracer.remember(fmt.Sprint(value), s.span.SpanContext())
+	}
+}
+
+func (s *Span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *Span) End() {
+	s.span.End()
+}
+
+func attr(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
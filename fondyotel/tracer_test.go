@@ -0,0 +1,62 @@
+package fondyotel
+
+import (
+	"github.com/srostyslav/fondy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http/httptest"
+	"net/http"
+	"context"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.Write([]byte(`{"response": {"response_status": "success", "token": "abc"}}`))
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider.Tracer("fondy"), propagation.TraceContext{})
+
+	a := fondy.NewApi(&fondy.ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	a.ApiUrl = server.URL + "/api"
+	a.Use(fondy.TracingMiddleware(tracer))
+
+	if _, err := a.CheckoutToken(&fondy.Checkout{OrderID: "order-1", Amount: 100, Currency: "USD"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, span := fondy.TraceCallback(context.Background(), tracer, "order-1", 1396424)
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	call, callback := spans[0], spans[1]
+	if call.Name() != "fondy checkout/token" {
+		t.Error("unexpected span name: " + call.Name())
+	}
+	if traceparent == "" || call.SpanContext().TraceID().String() != traceparent[3:35] {
+		t.Error("trace context is not propagated: " + traceparent)
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range call.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["fondy.order_id"].AsString() != "order-1" || attrs["fondy.merchant_id"].AsInt64() != 1396424 || attrs["http.response.status_code"].AsInt64() != 200 {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+
+	if links := callback.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != call.SpanContext().SpanID() {
+		t.Errorf("callback span is not linked to the order: %v", links)
+	}
+}
@@ -0,0 +1,338 @@
+package fondy
+
+import (
+	"strconv"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"fmt"
+)
+
+const (
+	HoldOpen		= "open"
+	HoldCaptured		= "captured"
+	HoldReleased		= "released"
+	HoldExpired		= "expired"
+
+	AutoNone		= ""
+	AutoCapture		= "capture"
+	AutoRelease		= "release"
+)
+
+var (
+	ErrHoldBusy		= errors.New("Hold has a capture or release in progress")
+	ErrReleasePending	= errors.New("Hold release is pending")
+)
+
+// Hold is a preauthorized order waiting for Capture or Reverse, amounts are in minor units.
+type Hold struct {
+	OrderID					string 		`json:"order_id"`
+	Amount					int64 		`json:"amount"`
+	Captured				int64 		`json:"captured"`
+	Currency				string 		`json:"currency"`
+	Status					string 		`json:"status"`
+	Auto					string 		`json:"auto"`		// action taken before expiry
+	CreatedAt				time.Time	`json:"created_at"`
+	ExpiresAt				time.Time	`json:"expires_at"`
+	Alerted					bool 		`json:"alerted"`
+	Error					string 		`json:"error,omitempty"`	// last failed action
+	Pending					string 		`json:"pending,omitempty"`	// reverse status of a release not final yet
+}
+
+type HoldStore interface {
+	Save(hold Hold) error
+	Get(orderID string) (Hold, bool, error)
+	Open() ([]Hold, error)
+}
+
+type MemoryHoldStore struct {
+	mu		sync.Mutex
+	holds		map[string]Hold
+}
+
+func (s *MemoryHoldStore) Save(hold Hold) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.holds == nil {
+		s.holds = map[string]Hold{}
+	}
+	s.holds[hold.OrderID] = hold
+	return nil
+}
+
+func (s *MemoryHoldStore) Get(orderID string) (Hold, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hold, ok := s.holds[orderID]
+	return hold, ok, nil
+}
+
+func (s *MemoryHoldStore) Open() ([]Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var holds []Hold
+	for _, hold := range s.holds {
+		if hold.Status == HoldOpen {
+			holds = append(holds, hold)
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ExpiresAt.Before(holds[j].ExpiresAt) })
+	return holds, nil
+}
+
+// HoldManager tracks open preauths and captures or releases them before they expire.
+type HoldManager struct {
+	Api		*Api
+	Store		HoldStore		// in memory when nil
+	Lifetime	time.Duration		// how long a hold lives, 7 days by default
+	Lead		time.Duration		// auto action runs this long before expiry, 24 hours by default
+	AlertBefore	time.Duration		// alert window before expiry, 48 hours by default
+	OnAlert		func(hold Hold)		// called once per hold entering the alert window
+	OnError		func(hold Hold, err error)
+	Now		func() time.Time
+
+	mu		sync.Mutex		// guards store updates, never held while calling Fondy or callbacks
+	busy		map[string]bool		// holds with a capture or release in flight
+}
+
+func (m *HoldManager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *HoldManager) store() HoldStore {
+	if m.Store == nil {
+		m.Store = &MemoryHoldStore{}
+	}
+	return m.Store
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// Track starts tracking a preauth created by a Checkout or PCIDSSOneStep with Preauth "Y".
+func (m *HoldManager) Track(orderID string, amount int64, currency string, auto string) (Hold, error) {
+	if auto != AutoNone && auto != AutoCapture && auto != AutoRelease {
+		return Hold{}, errors.New("Unknown auto action: " + auto)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	hold := Hold{
+		OrderID: orderID,
+		Amount: amount,
+		Currency: currency,
+		Status: HoldOpen,
+		Auto: auto,
+		CreatedAt: now,
+		ExpiresAt: now.Add(orDefault(m.Lifetime, 7 * 24 * time.Hour)),
+	}
+	return hold, m.store().Save(hold)
+}
+
+// begin marks an open hold busy so only one capture or release of it runs at a time.
+func (m *HoldManager) begin(orderID string) (Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, ok, err := m.store().Get(orderID)
+	if err != nil {
+		return hold, err
+	} else if !ok {
+		return hold, errors.New("Hold is not tracked: " + orderID)
+	} else if hold.Status != HoldOpen {
+		return hold, errors.New(fmt.Sprintf("Hold %s is %s", orderID, hold.Status))
+	} else if m.busy[orderID] {
+		return hold, fmt.Errorf("%w: %s", ErrHoldBusy, orderID)
+	}
+
+	if m.busy == nil {
+		m.busy = map[string]bool{}
+	}
+	m.busy[orderID] = true
+	return hold, nil
+}
+
+// finish applies update to the stored hold, which Tick may have changed meanwhile.
+func (m *HoldManager) finish(orderID string, update func(hold *Hold)) (Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.busy, orderID)
+	hold, _, err := m.store().Get(orderID)
+	if err != nil {
+		return hold, err
+	}
+	update(&hold)
+	return hold, m.store().Save(hold)
+}
+
+// Capture captures amount of the hold, less than the hold amount for a partial capture.
+func (m *HoldManager) Capture(orderID string, amount int64) (Hold, error) {
+	hold, err := m.begin(orderID)
+	if err != nil {
+		return hold, err
+	}
+	if amount <= 0 || amount > hold.Amount {
+		m.finish(orderID, func(*Hold) {})
+		return hold, errors.New(fmt.Sprintf("Capture amount %d must be within hold amount %d", amount, hold.Amount))
+	}
+	if hold.Pending != "" {
+		m.finish(orderID, func(*Hold) {})
+		return hold, fmt.Errorf("%w: %s", ErrReleasePending, hold.Pending)
+	}
+
+	status, err := m.Api.Capture(&Capture{OrderID: orderID, Amount: strconv.FormatInt(amount, 10), Currency: hold.Currency})
+	if err == nil && status != "captured" {
+		err = errors.New("Capture status: " + status)
+	}
+	if err != nil {
+		hold, _ = m.finish(orderID, func(h *Hold) { h.Error = err.Error() })
+		return hold, err
+	}
+
+	return m.finish(orderID, func(h *Hold) { h.Status, h.Captured, h.Error = HoldCaptured, amount, "" })
+}
+
+// Release reverses the whole hold. A reversal Fondy has not approved yet leaves the hold
+// open with Pending set, the next Release checks the order instead of reversing again.
+func (m *HoldManager) Release(orderID string) (Hold, error) {
+	hold, err := m.begin(orderID)
+	if err != nil {
+		return hold, err
+	}
+
+	if hold.Pending != "" {
+		return m.checkRelease(hold)
+	}
+
+	status, err := m.Api.Reverse(&Reverse{OrderID: orderID, Amount: strconv.FormatInt(hold.Amount, 10), Currency: hold.Currency, Comment: "preauth release"})
+	if err == nil && status == "declined" {
+		err = errors.New("Reverse status: " + status)
+	}
+	if err != nil {
+		hold, _ = m.finish(orderID, func(h *Hold) { h.Error = err.Error() })
+		return hold, err
+	}
+
+	if status != "approved" {
+		if status == "" {
+			status = "unknown"
+		}
+		hold, err = m.finish(orderID, func(h *Hold) { h.Pending, h.Error = status, "" })
+		if err != nil {
+			return hold, err
+		}
+		return hold, fmt.Errorf("%w: %s", ErrReleasePending, status)
+	}
+	return m.finish(orderID, func(h *Hold) { h.Status, h.Error = HoldReleased, "" })
+}
+
+// checkRelease looks up the order of a pending release, the hold stays pending until it is reversed.
+func (m *HoldManager) checkRelease(hold Hold) (Hold, error) {
+	order, err := m.Api.GetOrderStatus(hold.OrderID)
+	if err != nil {
+		hold, _ = m.finish(hold.OrderID, func(h *Hold) { h.Error = err.Error() })
+		return hold, err
+	}
+
+	reversed, err := parseAmount(order["reversal_amount"])
+	if err != nil {
+		m.finish(hold.OrderID, func(*Hold) {})
+		return hold, err
+	}
+
+	switch status := toString(order["order_status"]); {
+	case status == "reversed" || reversed >= hold.Amount:
+		return m.finish(hold.OrderID, func(h *Hold) { h.Status, h.Pending, h.Error = HoldReleased, "", "" })
+	default:
+		hold, _ = m.finish(hold.OrderID, func(h *Hold) {})
+		return hold, fmt.Errorf("%w: order is %s", ErrReleasePending, status)
+	}
+}
+
+// Tick alerts on holds approaching expiry, runs due auto actions and marks expired holds.
+// The store is updated under the lock, Fondy and the callbacks are called after it is released.
+func (m *HoldManager) Tick() error {
+	m.mu.Lock()
+	holds, err := m.store().Open()
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	var alerts, due []Hold
+	now := m.now()
+	for _, hold := range holds {
+		if m.busy[hold.OrderID] {
+			continue
+		}
+		left := hold.ExpiresAt.Sub(now)
+
+		if left <= 0 {
+			hold.Status = HoldExpired
+			m.store().Save(hold)
+			continue
+		}
+
+		if !hold.Alerted && left <= orDefault(m.AlertBefore, 48 * time.Hour) {
+			hold.Alerted = true
+			m.store().Save(hold)
+			alerts = append(alerts, hold)
+		}
+
+		if (left <= orDefault(m.Lead, 24 * time.Hour) && hold.Auto != AutoNone) || hold.Pending != "" {
+			due = append(due, hold)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, hold := range alerts {
+		if m.OnAlert != nil {
+			m.OnAlert(hold)
+		}
+	}
+
+	for _, hold := range due {
+		var err error
+		switch {
+		case hold.Pending != "" || hold.Auto == AutoRelease:
+			_, err = m.Release(hold.OrderID)
+		case hold.Auto == AutoCapture:
+			_, err = m.Capture(hold.OrderID, hold.Amount)
+		}
+		if err != nil && !errors.Is(err, ErrHoldBusy) && m.OnError != nil {
+			m.OnError(hold, err)
+		}
+	}
+	return nil
+}
+
+// Run calls Tick every interval until ctx is done.
+func (m *HoldManager) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Tick(); err != nil && m.OnError != nil {
+			m.OnError(Hold{}, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
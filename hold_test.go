@@ -0,0 +1,122 @@
+package fondy
+
+import (
+	"testing"
+	"errors"
+	"time"
+)
+
+func TestHoldManager(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	calls := map[string]string{}
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		calls[order["order_id"].(string)] = endpoint + ":" + order["amount"].(string)
+		if endpoint == "capture" {
+			return map[string]interface{}{"order": map[string]interface{}{"capture_status": "captured"}}
+		}
+		return map[string]interface{}{"order": map[string]interface{}{"reverse_status": "approved"}}
+	})
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var alerts []string
+	m := &HoldManager{Api: a, Now: func() time.Time { return now }, OnAlert: func(h Hold) { alerts = append(alerts, h.OrderID) }}
+
+	m.Track("manual", 1000, "UAH", AutoNone)
+	m.Track("capture", 2000, "UAH", AutoCapture)
+	m.Track("release", 3000, "UAH", AutoRelease)
+	m.Track("expire", 4000, "UAH", AutoNone)
+
+	if hold, err := m.Capture("manual", 600); err != nil || hold.Captured != 600 || calls["manual"] != "capture:600" {
+		t.Errorf("partial capture: %+v %v", hold, err)
+	}
+	if _, err := m.Capture("manual", 100); err == nil {
+		t.Error("captured hold is captured again")
+	}
+
+	now = now.Add(5 * 24 * time.Hour + time.Hour)
+	m.Tick()
+	if len(alerts) != 3 || len(calls) != 1 {
+		t.Errorf("unexpected alerts %v and calls %v", alerts, calls)
+	}
+
+	now = now.Add(24 * time.Hour)
+	m.Tick()
+	m.Tick()
+	if calls["capture"] != "capture:2000" || calls["release"] != "reverse/order_id:3000" || len(alerts) != 3 {
+		t.Errorf("unexpected alerts %v and calls %v", alerts, calls)
+	}
+
+	now = now.Add(24 * time.Hour)
+	m.Tick()
+	for id, status := range map[string]string{"manual": HoldCaptured, "capture": HoldCaptured, "release": HoldReleased, "expire": HoldExpired} {
+		if hold, _, _ := m.Store.Get(id); hold.Status != status {
+			t.Errorf("%s: %s != %s", id, hold.Status, status)
+		}
+	}
+}
+
+func TestHoldManagerCallbacksOutsideLock(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		return map[string]interface{}{"order": map[string]interface{}{"reverse_status": "approved"}}
+	})
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &HoldManager{Api: a, Now: func() time.Time { return now }}
+	m.OnAlert = func(h Hold) {
+		if _, err := m.Release(h.OrderID); err != nil {
+			t.Errorf("release from OnAlert: %v", err)
+		}
+	}
+	m.Track("alert", 1000, "UAH", AutoNone)
+
+	done := make(chan error)
+	now = now.Add(5 * 24 * time.Hour + time.Hour)
+	go func() { done <- m.Tick() }()
+	select {
+	case err := <-done:
+		if hold, _, _ := m.Store.Get("alert"); err != nil || hold.Status != HoldReleased || !hold.Alerted {
+			t.Errorf("unexpected hold %+v %v", hold, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Tick deadlocks when OnAlert calls Release")
+	}
+}
+
+func TestHoldManagerPendingRelease(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	reverses, orderStatus := 0, "approved"
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		if endpoint == "status/order_id" {
+			return map[string]interface{}{"order": map[string]interface{}{"order_id": order["order_id"], "order_status": orderStatus}}
+		}
+		reverses++
+		return map[string]interface{}{"order": map[string]interface{}{"reverse_status": "processing"}}
+	})
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var errs []error
+	m := &HoldManager{Api: a, Now: func() time.Time { return now }, OnError: func(h Hold, err error) { errs = append(errs, err) }}
+	m.Track("release", 1000, "UAH", AutoNone)
+
+	if hold, err := m.Release("release"); !errors.Is(err, ErrReleasePending) || hold.Status != HoldOpen || hold.Pending != "processing" {
+		t.Errorf("processing reverse releases the hold: %+v %v", hold, err)
+	}
+	if _, err := m.Capture("release", 1000); !errors.Is(err, ErrReleasePending) {
+		t.Errorf("hold with a pending release is captured: %v", err)
+	}
+
+	m.Tick()
+	if hold, _, _ := m.Store.Get("release"); hold.Status != HoldOpen || reverses != 1 || len(errs) != 1 {
+		t.Errorf("pending release is reversed again: %+v %d %v", hold, reverses, errs)
+	}
+
+	orderStatus = "reversed"
+	m.Tick()
+	if hold, _, _ := m.Store.Get("release"); hold.Status != HoldReleased || hold.Pending != "" || reverses != 1 {
+		t.Errorf("reversed order does not release the hold: %+v %d", hold, reverses)
+	}
+}
@@ -0,0 +1,113 @@
+package fondy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+	"fmt"
+)
+
+// Exchange is a single api call as it passes through the middleware chain.
+type Exchange struct {
+	Context			context.Context			// context of the call, used for the http request
+	Endpoint		string				// api path without slashes, e.g. "checkout/url"
+	Order			map[string]interface{}		// order payload, signed and encoded by the transport
+	Header			http.Header			// headers sent with the request
+	Request			*http.Request			// outgoing request, set by the transport
+	Response		*http.Response			// http response, its body is already read into Body
+	StatusCode		int
+	Body			[]byte				// raw response content
+	Start			time.Time
+	Duration		time.Duration
+
+	api			*Api
+	target			interface{}
+	checkSignature		bool
+	result			Response			// status decoded from resultOf, the Body it was cached for
+	resultOf		[]byte
+}
+
+// Handler performs the call described by the exchange.
+type Handler func(ex *Exchange) error
+
+// Middleware wraps a handler. It may modify the exchange before calling next,
+// inspect it afterwards, or return without calling next to short-circuit the call.
+type Middleware func(next Handler) Handler
+
+// chain is copied on write, so Use is safe while calls are running and
+// a call keeps the middleware it started with.
+type chain struct {
+	mu		sync.Mutex
+	middleware	[]Middleware
+}
+
+// Use appends middleware to the chain, the first one added is the outermost.
+func (a *Api) Use(middleware ...Middleware) {
+	if a.chain == nil {
+		a.chain = &chain{}
+	}
+	a.chain.mu.Lock()
+	defer a.chain.mu.Unlock()
+	a.chain.middleware = append(a.chain.middleware[:len(a.chain.middleware):len(a.chain.middleware)], middleware...)
+}
+
+func (a *Api) handler() Handler {
+	var middleware []Middleware
+	if a.chain != nil {
+		a.chain.mu.Lock()
+		middleware = a.chain.middleware
+		a.chain.mu.Unlock()
+	}
+
+	h := Handler(a.transport)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Decode checks the status code and decodes Body into the target of the call.
+// Middleware that short-circuits with a canned StatusCode and Body should return it.
+func (e *Exchange) Decode() error {
+	if e.StatusCode == http.StatusTooManyRequests {
+		err := &RateLimitError{Body: string(e.Body)}
+		if e.Response != nil {
+			err.RetryAfter = retryAfter(e.Response.Header.Get("Retry-After"), time.Now())
+		}
+		return err
+	}
+	if e.StatusCode != 200 && e.StatusCode != 201 {
+		return &ResponseError{StatusCode: e.StatusCode, Body: e.Body}
+	}
+	strict := e.api.Options.StrictSignature
+	result, err := e.api.decode(e.Body, e.target, e.checkSignature || strict, strict)
+	if err == nil {
+		e.result, e.resultOf = result, e.Body
+	}
+	if isDecodeError(err) {
+		return &ResponseError{StatusCode: e.StatusCode, Body: e.Body, Err: err}
+	}
+	return err
+}
+
+// OrderID returns order_id of the order payload if any.
+func (e *Exchange) OrderID() string {
+	if v, ok := e.Order["order_id"]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Result returns response status and error code found in Body. It is cached by Decode,
+// so middleware calling it after the call does not parse the body again.
+func (e *Exchange) Result() Response {
+	if len(e.Body) == 0 {
+		return Response{}
+	}
+	if len(e.Body) != len(e.resultOf) || &e.Body[0] != &e.resultOf[0] {
+		e.result, _ = e.api.decode(e.Body, &struct{}{}, false, false)
+		e.resultOf = e.Body
+	}
+	return e.result
+}
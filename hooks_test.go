@@ -0,0 +1,122 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"errors"
+)
+
+// fakeFondy serves signed 2.0 responses built by reply from the decoded order of each request.
+func fakeFondy(t *testing.T, a *Api, reply func(endpoint string, order map[string]interface{}) interface{}) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Request struct {
+				Data		string	`json:"data"`
+				Signature	string	`json:"signature"`
+			} `json:"request"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if sign := a.GetSignature(body.Request.Data); sign != body.Request.Signature {
+			t.Error("request signature does not match")
+		}
+
+		var payload struct {
+			Order map[string]interface{} `json:"order"`
+		}
+		raw, _ := base64.StdEncoding.DecodeString(body.Request.Data)
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		data, _ := a.ToB64(reply(strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "api/"), payload.Order))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"response": map[string]interface{}{
+				"data": data,
+				"signature": a.GetSignature(data),
+			},
+		})
+	}))
+	a.ApiUrl = server.URL + "/api"
+	return server
+}
+
+func checkoutReply(endpoint string, order map[string]interface{}) interface{} {
+	return map[string]interface{}{"order": map[string]interface{}{
+		"response_status": "success",
+		"checkout_url": "https://pay.fondy.eu/" + order["order_id"].(string),
+	}}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, checkoutReply)
+	defer server.Close()
+
+	var calls []string
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			calls = append(calls, "outer:" + ex.Endpoint)
+			ex.Order["order_id"] = "changed"
+			err := next(ex)
+			calls = append(calls, "outer:done")
+			return err
+		}
+	}, func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			calls = append(calls, "inner:" + ex.OrderID())
+			ex.Header.Set("X-Request-Id", "42")
+			err := next(ex)
+			if ex.Request.Header.Get("X-Request-Id") != "42" {
+				t.Error("header is not sent")
+			}
+			if ex.StatusCode != 200 || ex.Result().ResponseStatus != "success" {
+				t.Errorf("unexpected result: %d %v", ex.StatusCode, ex.Result())
+			}
+			return err
+		}
+	})
+
+	url, err := a.CheckoutUrl(&Checkout{OrderID: "original", OrderDesc: "test", Amount: 100, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if url != "https://pay.fondy.eu/changed" {
+		t.Error("order is not modified: " + url)
+	}
+	if got := strings.Join(calls, ","); got != "outer:checkout/url,inner:changed,outer:done" {
+		t.Error("unexpected chain: " + got)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	a.ApiUrl = "http://127.0.0.1:0/api"
+
+	fault := errors.New("injected")
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			if ex.Endpoint == "reverse/order_id" {
+				return fault
+			}
+			data, _ := a.ToB64(map[string]interface{}{"order": map[string]interface{}{"capture_status": "captured"}})
+			ex.StatusCode = 200
+			ex.Body, _ = json.Marshal(map[string]interface{}{"response": map[string]interface{}{"data": data, "signature": a.GetSignature(data)}})
+			return ex.Decode()
+		}
+	})
+
+	if _, err := a.Reverse(&Reverse{OrderID: "1"}); err != fault {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	if status, err := a.Capture(&Capture{OrderID: "1"}); err != nil || status != "captured" {
+		t.Errorf("unexpected capture result: %q %v", status, err)
+	}
+}
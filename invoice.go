@@ -0,0 +1,369 @@
+package fondy
+
+import (
+	"rsc.io/qr"
+	"html/template"
+	"strconv"
+	"slices"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"fmt"
+	"io"
+)
+
+const (
+	InvoiceOpen		= "open"
+	InvoicePaid		= "paid"
+	InvoiceOverdue		= "overdue"	// due date passed unpaid, Renew issues a new link
+)
+
+var (
+	ErrInvoiceNotFound	= errors.New("Invoice is not found")
+	ErrInvoiceOverpaid	= errors.New("Invoice is already paid")	// another order of the invoice was approved, refund it
+)
+
+// InvoiceItem is a line of an invoice, Price is in minor units.
+type InvoiceItem struct {
+	Name					string 		`json:"name"`
+	Quantity				int64 		`json:"quantity"`
+	Price					int64 		`json:"price"`
+}
+
+func (i InvoiceItem) Total() int64 {
+	return i.Price * i.Quantity
+}
+
+// Invoice is a payment link with a due date, amounts are in minor units.
+type Invoice struct {
+	ID					string 		`json:"id"`		// prefix of the order ids of its links
+	Reference				string 		`json:"reference"`	// shown to the customer
+	Description				string 		`json:"description"`
+	Customer				string 		`json:"customer"`
+	Email					string 		`json:"email"`
+	Items					[]InvoiceItem	`json:"items"`
+	Amount					int64 		`json:"amount"`
+	Currency				string 		`json:"currency"`
+	DueAt					time.Time	`json:"due_at"`
+	Status					string 		`json:"status"`
+	OrderID					string 		`json:"order_id"`	// order of the current link
+	URL					string 		`json:"url"`
+	LinkExpiresAt				time.Time	`json:"link_expires_at"`
+	Orders					[]string	`json:"orders"`		// order ids of every link issued
+	PaymentID				string 		`json:"payment_id,omitempty"`
+	PaidAt					time.Time	`json:"paid_at,omitempty"`
+	Overpaid				[]string	`json:"overpaid,omitempty"`	// approved orders after the invoice was paid
+	CreatedAt				time.Time	`json:"created_at"`
+}
+
+type InvoiceRepository interface {
+	Save(invoice Invoice) error
+	Get(id string) (Invoice, bool, error)
+	ByOrder(orderID string) (Invoice, bool, error)
+}
+
+type MemoryInvoiceRepository struct {
+	mu		sync.Mutex
+	invoices	map[string]Invoice
+	orders		map[string]string
+}
+
+func (r *MemoryInvoiceRepository) Save(invoice Invoice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.invoices == nil {
+		r.invoices, r.orders = map[string]Invoice{}, map[string]string{}
+	}
+	r.invoices[invoice.ID] = invoice
+	for _, orderID := range invoice.Orders {
+		r.orders[orderID] = invoice.ID
+	}
+	return nil
+}
+
+func (r *MemoryInvoiceRepository) Get(id string) (Invoice, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invoice, ok := r.invoices[id]
+	return invoice, ok, nil
+}
+
+func (r *MemoryInvoiceRepository) ByOrder(orderID string) (Invoice, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invoice, ok := r.invoices[r.orders[orderID]]
+	return invoice, ok, nil
+}
+
+// Invoicer issues invoices as CheckoutUrl links that live until the due date.
+type Invoicer struct {
+	Api			*Api
+	Repository		InvoiceRepository	// in memory when nil
+	ResponseUrl		string
+	ServerCallbackUrl	string
+	MaxLinkLifetime		time.Duration		// links are regenerated when the due date is further away, none when 0
+	Now			func() time.Time
+
+	mu			sync.Mutex
+}
+
+func (v *Invoicer) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+func (v *Invoicer) repository() InvoiceRepository {
+	if v.Repository == nil {
+		v.Repository = &MemoryInvoiceRepository{}
+	}
+	return v.Repository
+}
+
+// Create validates the invoice and issues its first payment link.
+// Amount is the sum of the items when it is 0.
+func (v *Invoicer) Create(invoice Invoice) (Invoice, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var total int64
+	for _, item := range invoice.Items {
+		if item.Quantity <= 0 || item.Price < 0 {
+			return invoice, errors.New("Invoice item quantity must be positive: " + item.Name)
+		}
+		total += item.Total()
+	}
+	if invoice.Amount == 0 {
+		invoice.Amount = total
+	}
+
+	now := v.now()
+	switch {
+	case invoice.ID == "" || invoice.Currency == "":
+		return invoice, errors.New("Invoice id and currency are required")
+	case invoice.Amount <= 0:
+		return invoice, errors.New("Invoice amount must be positive")
+	case len(invoice.Items) > 0 && total != invoice.Amount:
+		return invoice, errors.New(fmt.Sprintf("Invoice items total %d does not match amount %d", total, invoice.Amount))
+	case !invoice.DueAt.After(now):
+		return invoice, errors.New("Invoice due date must be in the future")
+	}
+	if _, ok, err := v.repository().Get(invoice.ID); err != nil {
+		return invoice, err
+	} else if ok {
+		return invoice, errors.New("Invoice already exists: " + invoice.ID)
+	}
+
+	invoice.Status, invoice.CreatedAt, invoice.Orders = InvoiceOpen, now, nil
+	return v.issue(invoice)
+}
+
+// issue creates a new checkout link living until the due date or MaxLinkLifetime.
+func (v *Invoicer) issue(invoice Invoice) (Invoice, error) {
+	now := v.now()
+	expires := invoice.DueAt
+	if v.MaxLinkLifetime > 0 && expires.Sub(now) > v.MaxLinkLifetime {
+		expires = now.Add(v.MaxLinkLifetime)
+	}
+
+	orderID := invoice.ID + "-" + strconv.Itoa(len(invoice.Orders) + 1)
+	description := invoice.Description
+	if description == "" {
+		description = "Invoice " + invoice.Reference
+	}
+
+	url, err := v.Api.CheckoutUrl(&Checkout{
+		OrderID: orderID,
+		OrderDesc: description,
+		Amount: invoice.Amount,
+		Currency: invoice.Currency,
+		Lifetime: int64(expires.Sub(now) / time.Second),
+		SenderEmail: invoice.Email,
+		ResponseUrl: v.ResponseUrl,
+		ServerCallbackUrl: v.ServerCallbackUrl,
+	})
+	if err != nil {
+		return invoice, err
+	}
+
+	invoice.OrderID, invoice.URL, invoice.LinkExpiresAt = orderID, url, expires
+	invoice.Orders = append(invoice.Orders, orderID)
+	return invoice, v.repository().Save(invoice)
+}
+
+func (v *Invoicer) get(id string) (Invoice, error) {
+	invoice, ok, err := v.repository().Get(id)
+	if err != nil {
+		return invoice, err
+	} else if !ok {
+		return invoice, fmt.Errorf("%w: %s", ErrInvoiceNotFound, id)
+	}
+	return invoice, nil
+}
+
+// Link returns the invoice with a live payment link, an expired link of an
+// open invoice is regenerated. Past the due date the invoice becomes overdue.
+func (v *Invoicer) Link(id string) (Invoice, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	invoice, err := v.get(id)
+	if err != nil || invoice.Status != InvoiceOpen {
+		return invoice, err
+	}
+
+	now := v.now()
+	if !now.Before(invoice.DueAt) {
+		invoice.Status = InvoiceOverdue
+		return invoice, v.repository().Save(invoice)
+	}
+	if !now.Before(invoice.LinkExpiresAt) {
+		return v.issue(invoice)
+	}
+	return invoice, nil
+}
+
+// Renew moves the due date of an unpaid invoice and issues a new link.
+func (v *Invoicer) Renew(id string, due time.Time) (Invoice, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	invoice, err := v.get(id)
+	if err != nil {
+		return invoice, err
+	}
+	if invoice.Status == InvoicePaid {
+		return invoice, errors.New("Invoice is paid: " + id)
+	}
+	if !due.After(v.now()) {
+		return invoice, errors.New("Invoice due date must be in the future")
+	}
+	invoice.Status, invoice.DueAt = InvoiceOpen, due
+	return v.issue(invoice)
+}
+
+// HandleCallback verifies a server callback and marks the invoice of its order paid.
+func (v *Invoicer) HandleCallback(content []byte) (Invoice, error) {
+	order, err := v.Api.ParseCallback(content)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	orderID := toString(order["order_id"])
+	invoice, ok, err := v.repository().ByOrder(orderID)
+	if err != nil {
+		return invoice, err
+	} else if !ok {
+		return invoice, fmt.Errorf("%w: order %s", ErrInvoiceNotFound, orderID)
+	}
+
+	if toString(order["order_status"]) != "approved" || (invoice.Status == InvoicePaid && invoice.PaymentID == toString(order["payment_id"])) {
+		return invoice, nil
+	}
+	if invoice.Status == InvoicePaid {
+		if !slices.Contains(invoice.Overpaid, orderID) {
+			invoice.Overpaid = append(invoice.Overpaid, orderID)
+			if err := v.repository().Save(invoice); err != nil {
+				return invoice, err
+			}
+		}
+		return invoice, fmt.Errorf("%w: order %s is paid too", ErrInvoiceOverpaid, orderID)
+	}
+	amount, err := parseAmount(order["amount"])
+	if err != nil {
+		return invoice, err
+	}
+	if amount != invoice.Amount || toString(order["currency"]) != invoice.Currency {
+		return invoice, errors.New(fmt.Sprintf("Invoice %s is paid with %v %v", invoice.ID, order["amount"], order["currency"]))
+	}
+
+	invoice.Status, invoice.PaidAt, invoice.PaymentID = InvoicePaid, v.now(), toString(order["payment_id"])
+	return invoice, v.repository().Save(invoice)
+}
+
+// QRCode renders text as an inline SVG QR code.
+func QRCode(text string) (template.HTML, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	const quiet = 4
+	size := code.Size + 2 * quiet
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x + quiet, y + quiet)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return template.HTML(b.String()), nil
+}
+
+// formatMinor formats an amount in minor units, e.g. 12550 as 125.50.
+func formatMinor(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount / 100, amount % 100)
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{"money": formatMinor}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Reference}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: .4em; border-bottom: 1px solid #ccc; text-align: left; }
+td.amount, th.amount { text-align: right; }
+.qr { width: 12em; }
+@media print { a { color: inherit; text-decoration: none; } }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Reference}}</h1>
+{{with .Customer}}<p>{{.}}</p>{{end}}
+{{with .Description}}<p>{{.}}</p>{{end}}
+<p>Due {{.DueAt.Format "02.01.2006"}}</p>
+<table>
+<tr><th>Item</th><th class="amount">Quantity</th><th class="amount">Price</th><th class="amount">Total</th></tr>
+{{range .Items}}<tr><td>{{.Name}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{money .Price}}</td><td class="amount">{{money .Total}}</td></tr>
+{{end}}<tr><th colspan="3">Total</th><th class="amount">{{money .Amount}} {{.Currency}}</th></tr>
+</table>
+{{if eq .Status "paid"}}<p>Paid {{.PaidAt.Format "02.01.2006"}}</p>{{else if .URL}}
+<p>Pay at <a href="{{.URL}}">{{.URL}}</a></p>
+<div class="qr">{{.QRCode}}</div>{{end}}
+</body>
+</html>
+`))
+
+// RenderInvoice writes a printable html invoice with the payment link and its QR code.
+func RenderInvoice(w io.Writer, invoice Invoice) error {
+	view := struct {
+		Invoice
+		QRCode	template.HTML
+	}{Invoice: invoice}
+
+	if invoice.URL != "" && invoice.Status != InvoicePaid {
+		code, err := QRCode(invoice.URL)
+		if err != nil {
+			return err
+		}
+		view.QRCode = code
+	}
+	return invoiceTemplate.Execute(w, view)
+}
@@ -0,0 +1,94 @@
+package fondy
+
+import (
+	"strings"
+	"testing"
+	"errors"
+	"bytes"
+	"time"
+)
+
+func TestInvoicer(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	var lifetimes []float64
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		lifetimes = append(lifetimes, order["lifetime"].(float64))
+		return checkoutReply(endpoint, order)
+	})
+	defer server.Close()
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	v := &Invoicer{Api: a, MaxLinkLifetime: 7 * 24 * time.Hour, Now: func() time.Time { return now }}
+
+	if _, err := v.Create(Invoice{ID: "inv-1", Currency: "UAH", Amount: 500, Items: []InvoiceItem{{Name: "Book", Quantity: 2, Price: 125}}, DueAt: now.Add(time.Hour)}); err == nil {
+		t.Error("items not matching the amount are accepted")
+	}
+
+	invoice, err := v.Create(Invoice{
+		ID: "inv-1",
+		Reference: "INV-2026-001",
+		Customer: "<Acme>",
+		Currency: "UAH",
+		Items: []InvoiceItem{{Name: "Book", Quantity: 2, Price: 12550}, {Name: "Delivery", Quantity: 1, Price: 5000}},
+		DueAt: now.Add(10 * 24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if invoice.Amount != 30100 || invoice.OrderID != "inv-1-1" || invoice.URL != "https://pay.fondy.eu/inv-1-1" || lifetimes[0] != 7 * 24 * 3600 {
+		t.Errorf("unexpected invoice: %+v, lifetimes %v", invoice, lifetimes)
+	}
+
+	now = now.Add(8 * 24 * time.Hour)
+	if invoice, err = v.Link("inv-1"); err != nil || invoice.OrderID != "inv-1-2" || lifetimes[1] != 2 * 24 * 3600 {
+		t.Errorf("expired link is not regenerated: %+v %v", invoice, err)
+	}
+
+	now = now.Add(3 * 24 * time.Hour)
+	if invoice, _ = v.Link("inv-1"); invoice.Status != InvoiceOverdue {
+		t.Errorf("invoice is not overdue: %s", invoice.Status)
+	}
+	if invoice, err = v.Renew("inv-1", now.Add(24 * time.Hour)); err != nil || invoice.Status != InvoiceOpen || invoice.OrderID != "inv-1-3" {
+		t.Errorf("invoice is not renewed: %+v %v", invoice, err)
+	}
+
+	// a customer pays the first link, still open at Fondy
+	paid, err := v.HandleCallback(signedCallback(a, map[string]interface{}{"order_id": "inv-1-1", "order_status": "approved", "amount": 30100, "currency": "UAH", "payment_id": 42}))
+	if err != nil || paid.Status != InvoicePaid || paid.PaymentID != "42" {
+		t.Errorf("invoice is not paid: %+v %v", paid, err)
+	}
+	if _, err := v.HandleCallback(signedCallback(NewApi(&ApiOptions{MerchantID: 1, SecretKey: "other"}), map[string]interface{}{"order_id": "inv-1-2", "order_status": "approved"})); err == nil {
+		t.Error("unsigned callback is accepted")
+	}
+	if again, err := v.HandleCallback(signedCallback(a, map[string]interface{}{"order_id": "inv-1-1", "order_status": "approved", "amount": 30100, "currency": "UAH", "payment_id": 42})); err != nil || len(again.Overpaid) != 0 {
+		t.Errorf("repeated callback is not ignored: %+v %v", again, err)
+	}
+	// the customer pays the renewed link too
+	for i := 0; i < 2; i++ {
+		extra, err := v.HandleCallback(signedCallback(a, map[string]interface{}{"order_id": "inv-1-3", "order_status": "approved", "amount": 30100, "currency": "UAH", "payment_id": 43}))
+		if !errors.Is(err, ErrInvoiceOverpaid) || extra.PaymentID != "42" || len(extra.Overpaid) != 1 || extra.Overpaid[0] != "inv-1-3" {
+			t.Errorf("overpayment is not reported: %+v %v", extra, err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := RenderInvoice(&b, invoice); err != nil {
+		t.Fatal(err.Error())
+	}
+	page := b.String()
+	for _, want := range []string{"INV-2026-001", "&lt;Acme&gt;", "125.50", "301.00 UAH", `href="https://pay.fondy.eu/inv-1-3"`, "<svg"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("invoice has no %s: %s", want, page)
+		}
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	code, err := QRCode("https://pay.fondy.eu/merchants/test")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.HasPrefix(string(code), "<svg") || strings.Count(string(code), "h1v1h-1z") < 100 {
+		t.Errorf("unexpected qr code: %s", code)
+	}
+}
@@ -0,0 +1,206 @@
+package fondy
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"os"
+)
+
+var ErrNoSecretKey = errors.New("No merchant secret key")
+
+// Key is a merchant secret key, ID tells which key verified a signature.
+type Key struct {
+	ID		string
+	Secret		string
+}
+
+// KeyProvider returns merchant keys: the first one signs requests,
+// all of them are accepted when verifying responses and callbacks.
+type KeyProvider interface {
+	Keys() []Key
+}
+
+// StaticKeys is a fixed list of keys, primary first.
+type StaticKeys []Key
+
+func (k StaticKeys) Keys() []Key {
+	return k
+}
+
+// RotatingKeys keeps a primary key and the previous ones still accepted for verification.
+type RotatingKeys struct {
+	mu		sync.RWMutex
+	keys		[]Key
+}
+
+func NewRotatingKeys(primary Key, previous ...Key) *RotatingKeys {
+	return &RotatingKeys{keys: append([]Key{primary}, previous...)}
+}
+
+func (k *RotatingKeys) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]Key(nil), k.keys...)
+}
+
+// Rotate makes key primary, the current primary is still accepted until retired.
+func (k *RotatingKeys) Rotate(key Key) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append([]Key{key}, k.keys...)
+}
+
+// Retire stops accepting the key with id, the primary key cannot be retired.
+func (k *RotatingKeys) Retire(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := k.keys[:1]
+	for _, key := range k.keys[1:] {
+		if key.ID != id {
+			keys = append(keys, key)
+		}
+	}
+	k.keys = keys
+}
+
+// EnvKeys reads the primary key from CLOUDIPSP_SECRETKEY and comma separated previous
+// keys from CLOUDIPSP_SECRETKEY_PREVIOUS on every call, so changes apply without restart.
+// Unset variables give no keys.
+type EnvKeys struct{}
+
+func (EnvKeys) Keys() []Key {
+	var keys []Key
+	if secret := strings.TrimSpace(os.Getenv("CLOUDIPSP_SECRETKEY")); secret != "" {
+		keys = append(keys, Key{ID: "CLOUDIPSP_SECRETKEY", Secret: secret})
+	}
+	for _, secret := range strings.Split(os.Getenv("CLOUDIPSP_SECRETKEY_PREVIOUS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			keys = append(keys, Key{ID: "CLOUDIPSP_SECRETKEY_PREVIOUS", Secret: secret})
+		}
+	}
+	return keys
+}
+
+// FileKeys reads keys from a file with one "id:secret" (or just "secret") per line,
+// primary first, and reloads it when the file changes.
+type FileKeys struct {
+	Path		string
+	Interval	time.Duration		// how often the file is checked, one second by default
+
+	mu		sync.Mutex
+	keys		[]Key
+	modTime		time.Time
+	checked		time.Time
+}
+
+func NewFileKeys(path string) (*FileKeys, error) {
+	k := &FileKeys{Path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *FileKeys) Keys() []Key {
+	k.mu.Lock()
+	interval := k.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	stale := time.Since(k.checked) >= interval
+	k.mu.Unlock()
+
+	if stale {
+		// keep serving the last good keys if the file is broken
+		k.Reload()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.keys
+}
+
+// Reload reads the file if it was modified since the last load.
+func (k *FileKeys) Reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.checked = time.Now()
+
+	info, err := os.Stat(k.Path)
+	if err != nil {
+		return err
+	}
+	if k.keys != nil && info.ModTime().Equal(k.modTime) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(k.Path)
+	if err != nil {
+		return err
+	}
+
+	var keys []Key
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			if secret := strings.TrimSpace(line[i + 1:]); secret != "" {
+				keys = append(keys, Key{ID: line[:i], Secret: secret})
+			}
+		} else {
+			keys = append(keys, Key{ID: "key" + strconv.Itoa(len(keys)), Secret: line})
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("No keys in " + k.Path)
+	}
+
+	k.keys, k.modTime = keys, info.ModTime()
+	return nil
+}
+
+// usableKeys drops keys with an empty secret, anyone can sign with those.
+func usableKeys(keys []Key) []Key {
+	var output []Key
+	for _, key := range keys {
+		if key.Secret != "" {
+			output = append(output, key)
+		}
+	}
+	return output
+}
+
+// keys returns the usable keys of the provider, or SecretKey, none when both are empty.
+func (a *Api) keys() []Key {
+	if a.Options.Keys != nil {
+		if keys := usableKeys(a.Options.Keys.Keys()); len(keys) > 0 {
+			return keys
+		}
+	}
+	return usableKeys([]Key{{ID: "default", Secret: a.Options.SecretKey}})
+}
+
+// signingKey returns the primary key, requests are never signed with an empty secret.
+func (a *Api) signingKey() (Key, error) {
+	keys := a.keys()
+	if len(keys) == 0 {
+		return Key{}, ErrNoSecretKey
+	}
+	return keys[0], nil
+}
+
+func (a *Api) secrets() []string {
+	keys := a.keys()
+	secrets := make([]string, len(keys))
+	for i, key := range keys {
+		secrets[i] = key.Secret
+	}
+	return secrets
+}
@@ -0,0 +1,99 @@
+package fondy
+
+import (
+	"path/filepath"
+	"io/ioutil"
+	"testing"
+	"errors"
+	"time"
+	"os"
+)
+
+func TestRotatingKeys(t *testing.T) {
+	keys := NewRotatingKeys(Key{ID: "old", Secret: "old-secret"})
+	a := NewApi(&ApiOptions{MerchantID: 1396424, Keys: keys})
+	signer := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "old-secret"})
+
+	inflight := signedCallback(signer, map[string]interface{}{"order_id": "1"})
+
+	keys.Rotate(Key{ID: "new", Secret: "new-secret"})
+	if a.GetSignature("data") != signature("new-secret", "data") {
+		t.Error("requests are not signed with the new key")
+	}
+
+	var order map[string]interface{}
+	if key, err := a.VerifyCallback(inflight, &order); err != nil {
+		t.Fatal(err.Error())
+	} else if key.ID != "old" || order["order_id"] != "1" {
+		t.Errorf("unexpected key %v for order %v", key, order)
+	}
+
+	keys.Retire("old")
+	if _, err := a.VerifyCallback(inflight, &order); !errors.Is(err, ErrSignature) {
+		t.Errorf("retired key is accepted: %v", err)
+	}
+}
+
+func TestFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := ioutil.WriteFile(path, []byte("v1:first\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	keys, err := NewFileKeys(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	keys.Interval = time.Nanosecond
+
+	if got := keys.Keys(); len(got) != 1 || got[0] != (Key{ID: "v1", Secret: "first"}) {
+		t.Errorf("unexpected keys: %v", got)
+	}
+
+	ioutil.WriteFile(path, []byte("# rotated\nv2:second\nv1:first\n"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+
+	if got := keys.Keys(); len(got) != 2 || got[0].ID != "v2" || got[1].ID != "v1" {
+		t.Errorf("keys are not reloaded: %v", got)
+	}
+
+	os.Remove(path)
+	if got := keys.Keys(); len(got) != 2 {
+		t.Errorf("last good keys are lost: %v", got)
+	}
+}
+
+func TestEmptySecretKey(t *testing.T) {
+	t.Setenv("CLOUDIPSP_MERCHANT_ID", "1396424")
+	t.Setenv("CLOUDIPSP_SECRETKEY", "")
+	t.Setenv("CLOUDIPSP_SECRETKEY_PREVIOUS", "")
+
+	if keys := (EnvKeys{}).Keys(); len(keys) != 0 {
+		t.Errorf("unset env gives keys: %v", keys)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("api without a secret key is created")
+			}
+		}()
+		NewApi(&ApiOptions{MerchantID: 1396424, Keys: EnvKeys{}})
+	}()
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	a.Options.SecretKey, a.Options.Keys = "", StaticKeys{{ID: "empty"}}
+
+	if _, err := a.VerifySignature("data", signature("", "data")); !errors.Is(err, ErrSignature) {
+		t.Errorf("signature with an empty secret is accepted: %v", err)
+	}
+	if sign, err := a.Sign("data"); sign != "" || !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf("data is signed with an empty secret: %q %v", sign, err)
+	}
+	if sign := a.GetSignature("data"); sign != "" {
+		t.Errorf("data is signed with an empty secret: %q", sign)
+	}
+	if _, err := a.GetOrderStatus("order-1"); !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf("request is signed with an empty secret: %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package fondy
+
+import (
+	"net/http"
+	"strconv"
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"fmt"
+)
+
+var ErrRateLimited = errors.New("Rate limited")
+
+// RateLimitError is returned for http status 429 and by fail fast limiters.
+type RateLimitError struct {
+	RetryAfter	time.Duration
+	Body		string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// Limit is a token bucket of Rate calls per second with Burst, plus at most
+// MaxInFlight concurrent calls. Zero values are unlimited.
+type Limit struct {
+	Rate		float64
+	Burst		int
+	MaxInFlight	int
+}
+
+type LimiterStats struct {
+	InFlight	int
+	Waiting		int
+	Throttled	uint64		// responses with http status 429
+	Rejected	uint64		// calls refused by a fail fast limiter
+}
+
+// Limiter enforces a Limit, it also pauses all calls until a Retry-After passes.
+type Limiter struct {
+	limit		Limit
+
+	mu		sync.Mutex
+	tokens		float64
+	last		time.Time
+	blocked		time.Time
+	stats		LimiterStats
+	released	chan struct{}
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &Limiter{limit: limit, tokens: float64(limit.Burst), last: time.Now(), released: make(chan struct{})}
+}
+
+// reserve takes a slot or tells how long to wait, a nil channel means the wait is timed.
+func (l *Limiter) reserve(now time.Time) (time.Duration, chan struct{}) {
+	if l.limit.Rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+		if l.tokens > float64(l.limit.Burst) {
+			l.tokens = float64(l.limit.Burst)
+		}
+	}
+	l.last = now
+
+	if now.Before(l.blocked) {
+		return l.blocked.Sub(now), nil
+	}
+	if l.limit.MaxInFlight > 0 && l.stats.InFlight >= l.limit.MaxInFlight {
+		return 0, l.released
+	}
+	if l.limit.Rate > 0 && l.tokens < 1 {
+		return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second)), nil
+	}
+
+	if l.limit.Rate > 0 {
+		l.tokens--
+	}
+	l.stats.InFlight++
+	return 0, nil
+}
+
+// Acquire waits for a slot until ctx is done, or fails with a *RateLimitError
+// right away when failFast is set. Call release once the call is finished.
+func (l *Limiter) Acquire(ctx context.Context, failFast bool) (release func(), err error) {
+	waiting := false
+	defer func() {
+		if waiting {
+			l.mu.Lock()
+			l.stats.Waiting--
+			l.mu.Unlock()
+		}
+	}()
+
+	for {
+		l.mu.Lock()
+		wait, released := l.reserve(time.Now())
+		if wait == 0 && released == nil {
+			l.mu.Unlock()
+			return l.release, nil
+		}
+		if failFast {
+			l.stats.Rejected++
+			l.mu.Unlock()
+			return nil, &RateLimitError{RetryAfter: wait}
+		}
+		if !waiting {
+			waiting = true
+			l.stats.Waiting++
+		}
+		l.mu.Unlock()
+
+		if released == nil {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			}
+		} else {
+			select {
+			case <-released:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.InFlight--
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// Block pauses new calls for d, used when Fondy answers with Retry-After.
+func (l *Limiter) Block(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Throttled++
+	if until := time.Now().Add(d); until.After(l.blocked) {
+		l.blocked = until
+	}
+}
+
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// LimiterObserver is implemented by metrics collectors that record limiter state, like Metrics.
+type LimiterObserver interface {
+	ObserveLimiter(endpoint string, stats LimiterStats)
+}
+
+type RateLimitOptions struct {
+	Default		Limit			// shared by all calls of the api
+	Endpoints	map[string]Limit	// per endpoint, e.g. "status/order_id"
+	FailFast	bool			// fail with *RateLimitError instead of waiting
+	MaxRetries	int			// retries of a 429 response after Retry-After
+	RetryAfter	time.Duration		// wait when a 429 response has no Retry-After, one second by default
+	Observer	LimiterObserver
+}
+
+// RateLimiter limits calls of an api as a whole and per endpoint.
+type RateLimiter struct {
+	options		RateLimitOptions
+	global		*Limiter
+
+	mu		sync.Mutex
+	endpoints	map[string]*Limiter
+}
+
+func NewRateLimiter(options RateLimitOptions) *RateLimiter {
+	if options.RetryAfter == 0 {
+		options.RetryAfter = time.Second
+	}
+	return &RateLimiter{options: options, global: NewLimiter(options.Default), endpoints: map[string]*Limiter{}}
+}
+
+func (r *RateLimiter) endpoint(name string) *Limiter {
+	limit, ok := r.options.Endpoints[name]
+	if !ok {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.endpoints[name]
+	if !ok {
+		l = NewLimiter(limit)
+		r.endpoints[name] = l
+	}
+	return l
+}
+
+// Stats returns limiter state by endpoint, the api wide limiter is under "".
+func (r *RateLimiter) Stats() map[string]LimiterStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := map[string]LimiterStats{"": r.global.Stats()}
+	for name, l := range r.endpoints {
+		stats[name] = l.Stats()
+	}
+	return stats
+}
+
+func (r *RateLimiter) observe(name string, l *Limiter) {
+	if r.options.Observer != nil && l != nil {
+		r.options.Observer.ObserveLimiter(name, l.Stats())
+	}
+}
+
+// acquire waits on the endpoint limiter before the api wide one, so a call waiting
+// for a busy endpoint holds no global slot and other endpoints keep going.
+func (r *RateLimiter) acquire(ctx context.Context, endpoint string) (func(), error) {
+	releaseEndpoint := func() {}
+	l := r.endpoint(endpoint)
+	if l != nil {
+		var err error
+		releaseEndpoint, err = l.Acquire(ctx, r.options.FailFast)
+		r.observe(endpoint, l)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := r.global.Acquire(ctx, r.options.FailFast)
+	r.observe("", r.global)
+	if err != nil {
+		releaseEndpoint()
+		r.observe(endpoint, l)
+		return nil, err
+	}
+	return func() {
+		release()
+		releaseEndpoint()
+		r.observe("", r.global)
+		r.observe(endpoint, l)
+	}, nil
+}
+
+func (r *RateLimiter) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			for attempt := 0; ; attempt++ {
+				release, err := r.acquire(ex.Context, ex.Endpoint)
+				if err != nil {
+					return err
+				}
+				err = next(ex)
+				release()
+
+				var limited *RateLimitError
+				if !errors.As(err, &limited) || ex.StatusCode != http.StatusTooManyRequests {
+					return err
+				}
+
+				wait := limited.RetryAfter
+				if wait == 0 {
+					wait = r.options.RetryAfter
+				}
+				r.global.Block(wait)
+				if l := r.endpoint(ex.Endpoint); l != nil {
+					l.Block(wait)
+				}
+				r.observe("", r.global)
+
+				if attempt >= r.options.MaxRetries {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"net/http"
+	"context"
+	"testing"
+	"errors"
+	"sync"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Limit{Rate: 20, Burst: 2, MaxInFlight: 3})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		release, err := l.Acquire(ctx, false)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 90 * time.Millisecond {
+		t.Errorf("burst is exceeded: %s", elapsed)
+	}
+
+	if _, err := l.Acquire(ctx, true); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected fail fast, got %v", err)
+	}
+
+	l = NewLimiter(Limit{MaxInFlight: 1})
+	release, _ := l.Acquire(ctx, false)
+
+	timeout, cancel := context.WithTimeout(ctx, 20 * time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(timeout, false); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if r, err := l.Acquire(ctx, false); err != nil {
+			t.Error(err.Error())
+		} else {
+			r()
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if stats := l.Stats(); stats.InFlight != 1 || stats.Waiting != 1 || stats.Rejected != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	release()
+	wg.Wait()
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	var hits []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, time.Now())
+		if len(hits) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"response": {"response_status": "success", "token": "abc"}}`))
+	}))
+	defer server.Close()
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	a.ApiUrl = server.URL + "/api"
+
+	metrics := NewMetrics()
+	limiter := NewRateLimiter(RateLimitOptions{MaxRetries: 1, Observer: metrics, Endpoints: map[string]Limit{"checkout/token": {MaxInFlight: 1}}})
+	a.Use(limiter.Middleware())
+
+	if token, err := a.CheckoutToken(&Checkout{OrderID: "1"}); err != nil || token != "abc" {
+		t.Fatalf("unexpected result: %q %v", token, err)
+	}
+	if len(hits) != 2 || hits[1].Sub(hits[0]) < time.Second {
+		t.Errorf("Retry-After is not honored: %v", hits)
+	}
+	if stats := limiter.Stats(); stats[""].Throttled != 1 || stats["checkout/token"].InFlight != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	hits = nil
+	limiter = NewRateLimiter(RateLimitOptions{})
+	b := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	b.ApiUrl = server.URL + "/api"
+	b.Use(limiter.Middleware())
+	if _, err := b.CheckoutToken(&Checkout{OrderID: "1"}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected rate limit error, got %v", err)
+	}
+}
+
+func TestRateLimiterEndpointFirst(t *testing.T) {
+	ctx := context.Background()
+
+	r := NewRateLimiter(RateLimitOptions{Default: Limit{MaxInFlight: 2}, Endpoints: map[string]Limit{"busy": {MaxInFlight: 1}}})
+	release, _ := r.acquire(ctx, "busy")
+
+	waiting := make(chan struct{})
+	go func() {
+		if r, err := r.acquire(ctx, "busy"); err == nil {
+			r()
+		}
+		close(waiting)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, 100 * time.Millisecond)
+	defer cancel()
+	if other, err := r.acquire(timeout, "other"); err != nil {
+		t.Errorf("a call waiting for an endpoint holds a global slot: %v", err)
+	} else {
+		other()
+	}
+	release()
+	<-waiting
+
+	r = NewRateLimiter(RateLimitOptions{FailFast: true, Default: Limit{Rate: 0.001, Burst: 2}, Endpoints: map[string]Limit{"busy": {Rate: 0.001, Burst: 1}}})
+	if _, err := r.acquire(ctx, "busy"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := r.acquire(ctx, "busy"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected fail fast, got %v", err)
+	}
+	if _, err := r.acquire(ctx, "other"); err != nil {
+		t.Errorf("endpoint fail fast spends a global token: %v", err)
+	}
+}
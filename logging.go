@@ -0,0 +1,57 @@
+package fondy
+
+import (
+	"log/slog"
+)
+
+// LoggingMiddleware logs every api call with endpoint, order id, latency, http status
+// and Fondy error code. The redacted order payload is added at debug level.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			err := next(ex)
+
+			ctx := ex.Context
+
+			result := ex.Result()
+			attrs := []slog.Attr{
+				slog.String("endpoint", ex.Endpoint),
+				slog.Int64("merchant_id", ex.api.Options.MerchantID),
+				slog.String("order_id", ex.OrderID()),
+				slog.Duration("latency", ex.Duration),
+				slog.Int("status", ex.StatusCode),
+				slog.String("response_status", result.ResponseStatus),
+				slog.Int("error_code", result.ErrorCode),
+			}
+			if logger.Enabled(ctx, slog.LevelDebug) {
+				attrs = append(attrs, slog.Any("order", ex.redacted()))
+			}
+
+			level, msg := slog.LevelInfo, "fondy api call"
+			if err != nil {
+				level, msg = slog.LevelError, "fondy api call failed"
+				attrs = append(attrs, slog.Any("error", redactValue(err.Error(), ex.api.secrets()...)))
+			} else if result.ErrorCode > 0 {
+				level = slog.LevelWarn
+				attrs = append(attrs, slog.String("error_message", result.ErrorMessage))
+			}
+
+			logger.LogAttrs(ctx, level, msg, attrs...)
+			return err
+		}
+	}
+}
+
+func (e *Exchange) redacted() map[string]interface{} {
+	return Redact(e.Order, e.api.secrets()...)
+}
+
+// LogValue keeps card data and secrets out of logs when an exchange is logged directly.
+func (e *Exchange) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("endpoint", e.Endpoint),
+		slog.String("order_id", e.OrderID()),
+		slog.Int("status", e.StatusCode),
+		slog.Any("order", e.redacted()),
+	)
+}
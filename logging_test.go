@@ -0,0 +1,90 @@
+package fondy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"bytes"
+)
+
+func TestMaskPAN(t *testing.T) {
+	for pan, masked := range map[string]string{
+		"4444555566661111": "444455******1111",
+		"4444555511116666123": "444455*********6123",
+		"12345": "*****",
+	} {
+		if got := MaskPAN(pan); got != masked {
+			t.Errorf("%s: %s != %s", pan, got, masked)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	payload := map[string]interface{}{
+		"order_id": "1",
+		"card_number": "4444555566661111",
+		"cvv2": "123",
+		"expiry_date": "1224",
+		"rectoken": "token",
+		"order_desc": "secret-key inside",
+		"receiver": []interface{}{
+			map[string]interface{}{"requisites": map[string]interface{}{"card_number": float64(4444555566661111)}},
+		},
+	}
+	output := Redact(payload, "secret-key")
+
+	if _, ok := output["cvv2"]; ok {
+		t.Error("cvv2 is not dropped")
+	}
+	if output["card_number"] != "444455******1111" || output["expiry_date"] != redacted || output["rectoken"] != redacted {
+		t.Errorf("card data is not scrubbed: %v", output)
+	}
+	if output["order_desc"] != redacted + " inside" {
+		t.Errorf("secret is not scrubbed: %v", output["order_desc"])
+	}
+	nested := output["receiver"].([]interface{})[0].(map[string]interface{})["requisites"].(map[string]interface{})
+	if nested["card_number"] != "444455******1111" {
+		t.Errorf("nested card number is not masked: %v", nested)
+	}
+	if payload["cvv2"] != "123" {
+		t.Error("payload is modified")
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		if endpoint == "3dsecure_step1" {
+			return map[string]interface{}{"response_status": "success", "acs_url": "https://acs"}
+		}
+		return map[string]interface{}{"response_status": "failure", "error_code": 1013, "error_message": "Duplicate order_id"}
+	})
+	defer server.Close()
+
+	var buf bytes.Buffer
+	a.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	a.PcidssStep2(&PCIDSSTwoStep{OrderID: "order-1", Pareq: "pareq", Md: "md"})
+	a.PcidssStep1(&PCIDSSOneStep{OrderID: "order-2", CardNumber: Sensitive("4444555566661111"), Cvv2: Sensitive("987"), ExpiryDate: "1230"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(lines))
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err.Error())
+	}
+	if record["endpoint"] != "3dsecure_step2" || record["order_id"] != "order-1" || record["error_code"] != float64(1013) || record["level"] != "WARN" {
+		t.Errorf("unexpected record: %v", record)
+	}
+
+	if strings.Contains(lines[1], "4444555566661111") || strings.Contains(lines[1], "987") || strings.Contains(lines[1], "1224") {
+		t.Error("card data is logged: " + lines[1])
+	}
+	if !strings.Contains(lines[1], "444455******1111") {
+		t.Error("masked card number is not logged: " + lines[1])
+	}
+}
@@ -0,0 +1,154 @@
+package fondy
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/hmac"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MerchantDataLimit is the longest merchant_data Fondy accepts.
+const MerchantDataLimit = 2048
+
+var (
+	ErrMerchantDataTampered	= errors.New("Merchant data is tampered")
+	ErrMerchantDataKey	= errors.New("Merchant data key is empty")
+)
+
+// MerchantDataCodec protects merchant_data with a local key: HMAC-SHA256 signed
+// by default or AES-GCM encrypted when Encrypt is set (Key must be 16, 24 or 32 bytes).
+// A nil codec stores plain JSON.
+type MerchantDataCodec struct {
+	Key		[]byte
+	Encrypt		bool
+}
+
+const (
+	signedPrefix	= "s1."
+	sealedPrefix	= "e1."
+)
+
+var b64 = base64.RawURLEncoding
+
+func (c *MerchantDataCodec) mac(payload string) string {
+	h := hmac.New(sha256.New, c.Key)
+	io.WriteString(h, payload)
+	return b64.EncodeToString(h.Sum(nil))
+}
+
+func (c *MerchantDataCodec) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *MerchantDataCodec) encode(content []byte) (string, error) {
+	switch {
+	case c == nil:
+		return string(content), nil
+	case len(c.Key) == 0:
+		return "", ErrMerchantDataKey
+	case c.Encrypt:
+		aead, err := c.aead()
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		return sealedPrefix + b64.EncodeToString(aead.Seal(nonce, nonce, content, nil)), nil
+	}
+	payload := b64.EncodeToString(content)
+	return signedPrefix + payload + "." + c.mac(payload), nil
+}
+
+func (c *MerchantDataCodec) decode(s string) ([]byte, error) {
+	switch {
+	case c == nil:
+		return []byte(s), nil
+	case len(c.Key) == 0:
+		return nil, ErrMerchantDataKey
+	case c.Encrypt:
+		if !strings.HasPrefix(s, sealedPrefix) {
+			return nil, ErrMerchantDataTampered
+		}
+		sealed, err := b64.DecodeString(s[len(sealedPrefix):])
+		if err != nil {
+			return nil, ErrMerchantDataTampered
+		}
+		aead, err := c.aead()
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrMerchantDataTampered
+		}
+		content, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, ErrMerchantDataTampered
+		}
+		return content, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, signedPrefix), ".")
+	if !strings.HasPrefix(s, signedPrefix) || len(parts) != 2 || !hmac.Equal([]byte(c.mac(parts[0])), []byte(parts[1])) {
+		return nil, ErrMerchantDataTampered
+	}
+	return b64.DecodeString(parts[0])
+}
+
+// EncodeMerchantData serialises v as JSON merchant_data within MerchantDataLimit.
+func EncodeMerchantData(v interface{}, codec *MerchantDataCodec) (string, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	s, err := codec.encode(content)
+	if err != nil {
+		return "", err
+	}
+	if len(s) > MerchantDataLimit {
+		return "", errors.New(fmt.Sprintf("Merchant data is %d bytes, limit is %d", len(s), MerchantDataLimit))
+	}
+	return s, nil
+}
+
+// SetMerchantData attaches v to the checkout as merchant_data.
+func (c *Checkout) SetMerchantData(v interface{}, codec *MerchantDataCodec) error {
+	s, err := EncodeMerchantData(v, codec)
+	if err != nil {
+		return err
+	}
+	c.MerchantData = s
+	return nil
+}
+
+// DecodeMerchantData verifies merchant_data with codec and decodes it into T.
+func DecodeMerchantData[T any](s string, codec *MerchantDataCodec) (T, error) {
+	var v T
+	content, err := codec.decode(s)
+	if err != nil {
+		return v, err
+	}
+	return v, json.Unmarshal(content, &v)
+}
+
+// MerchantDataOf decodes merchant_data of an order returned by GetOrderStatus or a callback.
+func MerchantDataOf[T any](order map[string]interface{}, codec *MerchantDataCodec) (T, error) {
+	s, _ := order["merchant_data"].(string)
+	if s == "" {
+		var v T
+		return v, errors.New("Order has no merchant_data")
+	}
+	return DecodeMerchantData[T](s, codec)
+}
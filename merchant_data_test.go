@@ -0,0 +1,54 @@
+package fondy
+
+import (
+	"strings"
+	"testing"
+)
+
+type cartMeta struct {
+	CartID		string		`json:"cart_id"`
+	UserID		int64		`json:"user_id"`
+}
+
+func TestMerchantData(t *testing.T) {
+	meta := cartMeta{CartID: "cart-1", UserID: 42}
+
+	for name, codec := range map[string]*MerchantDataCodec{
+		"plain": nil,
+		"signed": {Key: []byte("local-key")},
+		"encrypted": {Key: []byte("0123456789abcdef"), Encrypt: true},
+	} {
+		checkout := &Checkout{OrderID: "1"}
+		if err := checkout.SetMerchantData(meta, codec); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if codec != nil && codec.Encrypt && strings.Contains(checkout.MerchantData, "cart-1") {
+			t.Errorf("%s: merchant_data is readable: %s", name, checkout.MerchantData)
+		}
+
+		order := map[string]interface{}{"order_id": "1", "merchant_data": checkout.MerchantData}
+		if got, err := MerchantDataOf[cartMeta](order, codec); err != nil || got != meta {
+			t.Errorf("%s: %v %v", name, got, err)
+		}
+
+		if codec != nil {
+			tampered := checkout.MerchantData[:len(checkout.MerchantData) - 2] + "xx"
+			if _, err := DecodeMerchantData[cartMeta](tampered, codec); err != ErrMerchantDataTampered {
+				t.Errorf("%s: tampered merchant_data is accepted: %v", name, err)
+			}
+		}
+	}
+
+	for _, codec := range []*MerchantDataCodec{{}, {Encrypt: true}} {
+		if _, err := EncodeMerchantData(meta, codec); err != ErrMerchantDataKey {
+			t.Errorf("merchant_data is encoded without a key: %v", err)
+		}
+		if _, err := DecodeMerchantData[cartMeta]("s1.e30." + (&MerchantDataCodec{}).mac("e30"), codec); err != ErrMerchantDataKey {
+			t.Errorf("merchant_data is decoded without a key: %v", err)
+		}
+	}
+
+	if _, err := EncodeMerchantData(strings.Repeat("x", MerchantDataLimit), nil); err == nil {
+		t.Error("merchant_data over the limit is accepted")
+	}
+}
@@ -0,0 +1,245 @@
+package fondy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"fmt"
+	"io"
+)
+
+// MetricsCollector receives api call and callback measurements. Implement it to
+// forward them into any metrics library, or use Metrics for a self contained one.
+type MetricsCollector interface {
+	ObserveRequest(endpoint string, merchantID int64, status int, duration time.Duration, err error)
+	ObserveErrorCode(endpoint string, merchantID int64, code int)
+	ObserveSignatureFailure(endpoint string, merchantID int64)
+	ObserveCallback(merchantID int64, orderStatus string)
+}
+
+// MetricsMiddleware reports every api call to the collector.
+func MetricsMiddleware(collector MetricsCollector) Middleware {
+	return func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			err := next(ex)
+
+			merchantID := ex.api.Options.MerchantID
+			if ex.Duration == 0 {
+				ex.Duration = time.Since(ex.Start)
+			}
+			collector.ObserveRequest(ex.Endpoint, merchantID, ex.StatusCode, ex.Duration, err)
+			if errors.Is(err, ErrSignature) {
+				collector.ObserveSignatureFailure(ex.Endpoint, merchantID)
+			}
+			if code := ex.Result().ErrorCode; code > 0 {
+				collector.ObserveErrorCode(ex.Endpoint, merchantID, code)
+			}
+			return err
+		}
+	}
+}
+
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogram struct {
+	counts	[]uint64
+	sum	float64
+	count	uint64
+}
+
+// Metrics is an in-memory MetricsCollector exposed in the Prometheus text format.
+type Metrics struct {
+	mu		sync.Mutex
+	buckets		[]float64
+	counters	map[string]map[string]float64
+	gauges		map[string]map[string]float64
+	histograms	map[string]*histogram
+	help		map[string]string
+}
+
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets: buckets,
+		counters: map[string]map[string]float64{},
+		gauges: map[string]map[string]float64{},
+		histograms: map[string]*histogram{},
+		help: map[string]string{
+			"fondy_requests_total": "Fondy api calls by endpoint, merchant and result.",
+			"fondy_request_duration_seconds": "Fondy api call latency.",
+			"fondy_error_codes_total": "Fondy error codes returned by endpoint and merchant.",
+			"fondy_signature_failures_total": "Responses and callbacks failed signature verification.",
+			"fondy_callbacks_total": "Callbacks received by merchant and order status.",
+			"fondy_limiter_in_flight": "Api calls holding a rate limiter slot.",
+			"fondy_limiter_waiting": "Api calls waiting for the rate limiter.",
+			"fondy_limiter_throttled_total": "Responses with http status 429.",
+			"fondy_limiter_rejected_total": "Api calls rejected by a fail fast rate limiter.",
+		},
+	}
+}
+
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs) / 2)
+	for i := 0; i + 1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i + 1])
+		parts = append(parts, pairs[i] + `="` + value + `"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func series(metrics map[string]map[string]float64, name string) map[string]float64 {
+	s, ok := metrics[name]
+	if !ok {
+		s = map[string]float64{}
+		metrics[name] = s
+	}
+	return s
+}
+
+// Add increments counter name with label pairs by value.
+func (m *Metrics) Add(name string, value float64, pairs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series(m.counters, name)[labels(pairs...)] += value
+}
+
+// Set sets gauge name with label pairs to value.
+func (m *Metrics) Set(name string, value float64, pairs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series(m.gauges, name)[labels(pairs...)] = value
+}
+
+func (m *Metrics) observe(seconds float64, pairs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := labels(pairs...)
+	h, ok := m.histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.histograms[key] = h
+	}
+	for i, le := range m.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (m *Metrics) ObserveRequest(endpoint string, merchantID int64, status int, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	merchant := strconv.FormatInt(merchantID, 10)
+	m.Add("fondy_requests_total", 1, "endpoint", endpoint, "merchant_id", merchant, "status", strconv.Itoa(status), "result", result)
+	m.observe(duration.Seconds(), "endpoint", endpoint, "merchant_id", merchant)
+}
+
+func (m *Metrics) ObserveErrorCode(endpoint string, merchantID int64, code int) {
+	m.Add("fondy_error_codes_total", 1, "endpoint", endpoint, "merchant_id", strconv.FormatInt(merchantID, 10), "code", strconv.Itoa(code))
+}
+
+func (m *Metrics) ObserveSignatureFailure(endpoint string, merchantID int64) {
+	m.Add("fondy_signature_failures_total", 1, "endpoint", endpoint, "merchant_id", strconv.FormatInt(merchantID, 10))
+}
+
+func (m *Metrics) ObserveCallback(merchantID int64, orderStatus string) {
+	m.Add("fondy_callbacks_total", 1, "merchant_id", strconv.FormatInt(merchantID, 10), "order_status", orderStatus)
+}
+
+func (m *Metrics) ObserveLimiter(endpoint string, stats LimiterStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := labels("endpoint", endpoint)
+	series(m.gauges, "fondy_limiter_in_flight")[key] = float64(stats.InFlight)
+	series(m.gauges, "fondy_limiter_waiting")[key] = float64(stats.Waiting)
+	series(m.counters, "fondy_limiter_throttled_total")[key] = float64(stats.Throttled)
+	series(m.counters, "fondy_limiter_rejected_total")[key] = float64(stats.Rejected)
+}
+
+// WriteTo writes all series in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	m.writeSeries(&b, m.counters, "counter")
+	m.writeSeries(&b, m.gauges, "gauge")
+
+	if len(m.histograms) > 0 {
+		name := "fondy_request_duration_seconds"
+		m.header(&b, name, "histogram")
+
+		keys := make([]string, 0, len(m.histograms))
+		for key := range m.histograms {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			h := m.histograms[key]
+			for i, le := range m.buckets {
+				fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", name, key, formatFloat(le), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key, h.count)
+			fmt.Fprintf(&b, "%s_sum{%s} %s\n", name, key, formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", name, key, h.count)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (m *Metrics) writeSeries(b *strings.Builder, metrics map[string]map[string]float64, typ string) {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m.header(b, name, typ)
+		for _, key := range sortedKeys(metrics[name]) {
+			fmt.Fprintf(b, "%s{%s} %s\n", name, key, formatFloat(metrics[name][key]))
+		}
+	}
+}
+
+func (m *Metrics) header(b *strings.Builder, name, typ string) {
+	if help, ok := m.help[name]; ok {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func sortedKeys(series map[string]float64) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,85 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		if endpoint == "capture" {
+			return map[string]interface{}{"response_status": "failure", "error_code": 1016, "error_message": "Merchant not found"}
+		}
+		return checkoutReply(endpoint, order)
+	})
+	defer server.Close()
+
+	metrics := NewMetrics(0.5, 1)
+	a.Use(MetricsMiddleware(metrics), func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			if ex.Endpoint != "reverse/order_id" {
+				return next(ex)
+			}
+			ex.StatusCode, ex.Body = 200, []byte(`{"response": {"data": "e30=", "signature": "tampered"}}`)
+			return ex.Decode()
+		}
+	})
+
+	a.CheckoutUrl(&Checkout{OrderID: "1", Amount: 100, Currency: "USD"})
+	a.CheckoutUrl(&Checkout{OrderID: "2", Amount: 100, Currency: "USD"})
+	a.Capture(&Capture{OrderID: "1"})
+
+	a.Reverse(&Reverse{OrderID: "1"})
+
+	metrics.ObserveCallback(1396424, "approved")
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	output := rec.Body.String()
+
+	for _, line := range []string{
+		`fondy_requests_total{endpoint="checkout/url",merchant_id="1396424",status="200",result="ok"} 2`,
+		`fondy_requests_total{endpoint="reverse/order_id",merchant_id="1396424",status="200",result="error"} 1`,
+		`fondy_error_codes_total{endpoint="capture",merchant_id="1396424",code="1016"} 1`,
+		`fondy_signature_failures_total{endpoint="reverse/order_id",merchant_id="1396424"} 1`,
+		`fondy_callbacks_total{merchant_id="1396424",order_status="approved"} 1`,
+		`fondy_request_duration_seconds_count{endpoint="checkout/url",merchant_id="1396424"} 2`,
+		`# TYPE fondy_request_duration_seconds histogram`,
+	} {
+		if !strings.Contains(output, line + "\n") {
+			t.Errorf("missing %s in:\n%s", line, output)
+		}
+	}
+}
+
+func TestCallbackMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test", Metrics: metrics})
+	other := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "other"})
+
+	a.ParseCallback(signedCallback(a, map[string]interface{}{"order_id": "1", "order_status": "approved"}))
+	a.ParseCallback(signedCallback(other, map[string]interface{}{"order_id": "2", "order_status": "approved"}))
+
+	r := NewRegistry()
+	second := r.Add(&ApiOptions{MerchantID: 1700002, SecretKey: "second", Metrics: metrics})
+	r.ParseCallback(signedCallback(second, map[string]interface{}{"order_id": "3", "order_status": "declined", "merchant_id": 1700002}))
+
+	req := httptest.NewRequest("POST", "/return", strings.NewReader(returnForm(other, map[string]interface{}{"order_id": "4"})))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	(&ReturnHandler{Api: a}).ServeHTTP(httptest.NewRecorder(), req)
+
+	var b strings.Builder
+	metrics.WriteTo(&b)
+	for _, line := range []string{
+		`fondy_callbacks_total{merchant_id="1396424",order_status="approved"} 1`,
+		`fondy_callbacks_total{merchant_id="1700002",order_status="declined"} 1`,
+		`fondy_signature_failures_total{endpoint="callback",merchant_id="1396424"} 1`,
+		`fondy_signature_failures_total{endpoint="return",merchant_id="1396424"} 1`,
+	} {
+		if !strings.Contains(b.String(), line + "\n") {
+			t.Errorf("missing %s in:\n%s", line, b.String())
+		}
+	}
+}
@@ -35,6 +35,8 @@ type Checkout struct {
 	Subscription				string 		`json:"subscription,omitempty"`
 	SubscriptionCallbackUrl			string 		`json:"subscription_callback_url,omitempty"`
 	RecurringData				*Recurring	`json:"recurring_data,omitempty"`
+	ReceiptData				*Receipt	`json:"receipt_data,omitempty"`	// fiscal receipt, see SetReceipt
+	ReservationData				*ReservationData	`json:"reservation_data,omitempty"`	// antifraud data, see SetReservation
 }
 
 type Requisites struct {
@@ -71,13 +73,14 @@ type PCIDSSOneStep struct {
 	OrderDesc				string 			`json:"order_desc,omitempty"`
 	Amount					string 			`json:"amount,omitempty"`
 	Currency				string 			`json:"currency,omitempty"`
-	CardNumber				string 			`json:"card_number,omitempty"`
-	Cvv2					string 			`json:"cvv2,omitempty"`
+	CardNumber				SensitiveString		`json:"card_number,omitempty"`
+	Cvv2					SensitiveString		`json:"cvv2,omitempty"`
 	ExpiryDate				string 			`json:"expiry_date,omitempty"`
 	ClientIP 				string 			`json:"client_ip,omitempty"`
 	Container				string 			`json:"container,omitempty"`
 	RequiredRectoken			string 			`json:"required_rectoken"`
 	Preauth					string 			`json:"preauth"`
+	ReservationData				*ReservationData	`json:"reservation_data,omitempty"`
 }
 
 type PCIDSSTwoStep struct {
@@ -87,7 +90,7 @@ type PCIDSSTwoStep struct {
 }
 
 type P2Pcredit struct {
-	ReceiverCardNumber			string			`json:"receiver_card_number,omitempty"`
+	ReceiverCardNumber			SensitiveString		`json:"receiver_card_number,omitempty"`
 	ReceiverRectoken			string 			`json:"receiver_rectoken,omitempty"`
 	OrderID 				string 			`json:"order_id"`
 	OrderDesc				string 			`json:"order_desc"`
@@ -107,6 +110,7 @@ type Capture struct {
 	OrderID 				string 			`json:"order_id"`
 	Amount					string 			`json:"amount"`
 	Currency				string 			`json:"currency"`
+	ReceiptData				*Receipt		`json:"receipt_data,omitempty"`
 }
 
 type Reverse struct {
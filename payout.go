@@ -0,0 +1,312 @@
+package fondy
+
+import (
+	"github.com/satori/go.uuid"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"context"
+	"errors"
+	"bufio"
+	"sync"
+	"time"
+	"os"
+)
+
+const (
+	PayoutPending		= "pending"	// sent, the outcome is not known yet
+	PayoutApproved		= "approved"
+	PayoutDeclined		= "declined"
+	PayoutFailed		= "failed"	// the call failed, it is checked and retried on the next run
+)
+
+// Payout is a single P2Pcredit of a batch, either CardNumber or Rectoken is required.
+// The caller wipes CardNumber once the batch is done, each call uses its own copy.
+type Payout struct {
+	ID					string 		`json:"id"`		// stable id in the caller system
+	CardNumber				SensitiveString	`json:"-"`
+	Rectoken				string 		`json:"-"`
+	Amount					int64 		`json:"amount"`
+	Currency				string 		`json:"currency"`
+	Description				string 		`json:"description"`
+}
+
+type PayoutResult struct {
+	ID					string 		`json:"id"`
+	OrderID					string 		`json:"order_id"`
+	Amount					int64 		`json:"amount"`
+	Currency				string 		`json:"currency"`
+	Status					string 		`json:"status"`
+	OrderStatus				string 		`json:"order_status,omitempty"`
+	Error					string 		`json:"error,omitempty"`
+	UpdatedAt				time.Time	`json:"updated_at"`
+}
+
+// PayoutStore persists per item progress of a batch so it can be resumed.
+type PayoutStore interface {
+	Load(batchID string) (map[string]PayoutResult, error)
+	Save(batchID string, result PayoutResult) error
+}
+
+// MemoryPayoutStore keeps progress in memory, useful for tests and one-off runs.
+type MemoryPayoutStore struct {
+	mu		sync.Mutex
+	batches		map[string]map[string]PayoutResult
+}
+
+func (s *MemoryPayoutStore) Load(batchID string) (map[string]PayoutResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output := map[string]PayoutResult{}
+	for k, v := range s.batches[batchID] {
+		output[k] = v
+	}
+	return output, nil
+}
+
+func (s *MemoryPayoutStore) Save(batchID string, result PayoutResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.batches == nil {
+		s.batches = map[string]map[string]PayoutResult{}
+	}
+	if s.batches[batchID] == nil {
+		s.batches[batchID] = map[string]PayoutResult{}
+	}
+	s.batches[batchID][result.ID] = result
+	return nil
+}
+
+// FilePayoutStore appends progress to Dir/<batch id>.jsonl, the last line of an item wins.
+type FilePayoutStore struct {
+	Dir		string
+	mu		sync.Mutex
+}
+
+func (s *FilePayoutStore) path(batchID string) string {
+	return filepath.Join(s.Dir, batchID + ".jsonl")
+}
+
+func (s *FilePayoutStore) Load(batchID string) (map[string]PayoutResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output := map[string]PayoutResult{}
+	f, err := os.Open(s.path(batchID))
+	if os.IsNotExist(err) {
+		return output, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var result PayoutResult
+		// a line torn by a crash is skipped, the item is checked again
+		if err := json.Unmarshal(scanner.Bytes(), &result); err == nil {
+			output[result.ID] = result
+		}
+	}
+	return output, scanner.Err()
+}
+
+func (s *FilePayoutStore) Save(batchID string, result PayoutResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path(batchID), os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type PayoutReport struct {
+	BatchID					string 		`json:"batch_id"`
+	Total					int 		`json:"total"`
+	Approved				int 		`json:"approved"`
+	Declined				int 		`json:"declined"`
+	Pending					int 		`json:"pending"`
+	Failed					int 		`json:"failed"`
+	Skipped					int 		`json:"skipped"`	// finished by a previous run
+	ApprovedAmount				int64 		`json:"approved_amount"`
+	Results					[]PayoutResult	`json:"results"`
+}
+
+// BatchPayout runs P2Pcredit payouts with bounded concurrency and rate.
+// Order ids are derived from BatchID and Payout.ID, so a rerun of the same batch
+// never pays an item twice: finished items are skipped and unfinished ones are
+// checked with GetOrderStatus before they are sent again.
+type BatchPayout struct {
+	Api			*Api
+	BatchID			string
+	Concurrency		int		// parallel calls, 1 by default
+	Rate			float64		// payouts per second, unlimited when 0
+	Store			PayoutStore	// in memory when nil
+}
+
+var payoutNamespace = uuid.NewV5(uuid.NamespaceURL, "https://github.com/srostyslav/fondy/payout")
+
+// PayoutOrderID returns the deterministic order id of a payout in a batch.
+func PayoutOrderID(batchID, payoutID string) string {
+	return uuid.NewV5(payoutNamespace, batchID + "/" + payoutID).String()
+}
+
+func (b *BatchPayout) Run(ctx context.Context, payouts []Payout) (*PayoutReport, error) {
+	if b.BatchID == "" {
+		return nil, errors.New("BatchID is required")
+	}
+	if b.Store == nil {
+		b.Store = &MemoryPayoutStore{}
+	}
+	concurrency := b.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	done, err := b.Store.Load(b.BatchID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, p := range payouts {
+		if p.ID == "" || seen[p.ID] {
+			return nil, errors.New("Payout ids must be unique and not empty: " + strconv.Quote(p.ID))
+		}
+		seen[p.ID] = true
+	}
+
+	var tick <-chan time.Time
+	if b.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	report := &PayoutReport{BatchID: b.BatchID, Total: len(payouts), Results: make([]PayoutResult, len(payouts))}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report.Results[i] = b.pay(ctx, payouts[i], done[payouts[i].ID])
+			}
+		}()
+	}
+
+feed:
+	for i, p := range payouts {
+		if prev, ok := done[p.ID]; ok && (prev.Status == PayoutApproved || prev.Status == PayoutDeclined) {
+			report.Results[i] = prev
+			report.Skipped++
+			continue
+		}
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, result := range report.Results {
+		if result.ID == "" {
+			report.Results[i] = PayoutResult{ID: payouts[i].ID, OrderID: PayoutOrderID(b.BatchID, payouts[i].ID), Amount: payouts[i].Amount, Currency: payouts[i].Currency, Status: PayoutPending, Error: "not started"}
+		}
+		switch report.Results[i].Status {
+		case PayoutApproved:
+			report.Approved++
+			report.ApprovedAmount += report.Results[i].Amount
+		case PayoutDeclined:
+			report.Declined++
+		case PayoutFailed:
+			report.Failed++
+		default:
+			report.Pending++
+		}
+	}
+	return report, ctx.Err()
+}
+
+func payoutStatus(orderStatus string) string {
+	switch orderStatus {
+	case "approved":
+		return PayoutApproved
+	case "declined", "expired", "reversed":
+		return PayoutDeclined
+	}
+	return PayoutPending
+}
+
+func (b *BatchPayout) pay(ctx context.Context, p Payout, prev PayoutResult) PayoutResult {
+	a := b.Api.WithContext(ctx)
+	result := PayoutResult{ID: p.ID, OrderID: PayoutOrderID(b.BatchID, p.ID), Amount: p.Amount, Currency: p.Currency}
+
+	save := func(r PayoutResult) PayoutResult {
+		r.UpdatedAt = time.Now()
+		if err := b.Store.Save(b.BatchID, r); err != nil && r.Error == "" {
+			r.Error = "store: " + err.Error()
+		}
+		return r
+	}
+
+	// the previous run may have sent the payout before it crashed
+	if prev.ID != "" {
+		if order, err := a.GetOrderStatus(result.OrderID); err == nil && order != nil {
+			if status, _ := order["order_status"].(string); status != "" {
+				result.OrderStatus, result.Status = status, payoutStatus(status)
+				return save(result)
+			}
+		}
+	}
+
+	result.Status = PayoutPending
+	save(result)
+
+	credit := &P2Pcredit{
+		ReceiverCardNumber: p.CardNumber.copy(),
+		ReceiverRectoken: p.Rectoken,
+		OrderID: result.OrderID,
+		OrderDesc: p.Description,
+		Currency: p.Currency,
+		Amount: strconv.FormatInt(p.Amount, 10),
+	}
+	order, err := a.P2Pcredit(credit)
+	credit.Wipe()
+	if err != nil {
+		result.Status, result.Error = PayoutFailed, err.Error()
+		return save(result)
+	}
+
+	result.OrderStatus, _ = order["order_status"].(string)
+	result.Status = payoutStatus(result.OrderStatus)
+	return save(result)
+}
@@ -0,0 +1,78 @@
+package fondy
+
+import (
+	"strings"
+	"context"
+	"testing"
+	"sync"
+)
+
+func TestBatchPayout(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1000, SecretKey: "testcredit"})
+
+	var mu sync.Mutex
+	orders := map[string]string{}
+	sent := 0
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := order["order_id"].(string)
+		if endpoint == "status/order_id" {
+			if status, ok := orders[id]; ok {
+				return map[string]interface{}{"order": map[string]interface{}{"order_id": id, "order_status": status}}
+			}
+			return map[string]interface{}{"order": map[string]interface{}{"response_status": "failure", "error_code": 1018, "error_message": "Order not found"}}
+		}
+
+		sent++
+		status := "approved"
+		if card, _ := order["receiver_card_number"].(string); strings.HasSuffix(card, "0000") {
+			status = "declined"
+		}
+		orders[id] = status
+		return map[string]interface{}{"order": map[string]interface{}{"order_id": id, "order_status": status}}
+	})
+	defer server.Close()
+
+	payouts := []Payout{
+		{ID: "seller-1", CardNumber: Sensitive("4444555566661111"), Amount: 1000, Currency: "UAH"},
+		{ID: "seller-2", CardNumber: Sensitive("4444555566050000"), Amount: 2000, Currency: "UAH"},
+		{ID: "seller-3", Rectoken: "token", Amount: 3000, Currency: "UAH"},
+		{ID: "seller-4", CardNumber: Sensitive("5555555555554444"), Amount: 4000, Currency: "UAH"},
+	}
+
+	store := &FilePayoutStore{Dir: t.TempDir()}
+
+	// a previous run sent seller-4 and crashed before saving the outcome
+	store.Save("2024-01-01", PayoutResult{ID: "seller-4", Status: PayoutPending})
+	orders[PayoutOrderID("2024-01-01", "seller-4")] = "approved"
+
+	batch := &BatchPayout{Api: a, BatchID: "2024-01-01", Concurrency: 3, Rate: 1000, Store: store}
+	report, err := batch.Run(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if report.Approved != 3 || report.Declined != 1 || report.ApprovedAmount != 8000 || sent != 3 {
+		t.Errorf("unexpected report: %+v, sent %d", report, sent)
+	}
+	if report.Results[1].Status != PayoutDeclined || report.Results[1].OrderID != PayoutOrderID("2024-01-01", "seller-2") {
+		t.Errorf("unexpected result: %+v", report.Results[1])
+	}
+
+	if payouts[0].CardNumber.Reveal() != "4444555566661111" {
+		t.Error("payout card number is wiped by the call")
+	}
+
+	report, err = batch.Run(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if report.Skipped != 4 || report.Approved != 3 || sent != 3 {
+		t.Errorf("rerun is not idempotent: %+v, sent %d", report, sent)
+	}
+
+	if PayoutOrderID("2024-01-01", "seller-1") == PayoutOrderID("2024-01-02", "seller-1") {
+		t.Error("order ids of different batches collide")
+	}
+}
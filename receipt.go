@@ -0,0 +1,210 @@
+package fondy
+
+import (
+	"encoding/json"
+	"strconv"
+	"errors"
+	"math"
+	"fmt"
+)
+
+var (
+	VatRates	= []string{"none", "vat0", "vat10", "vat20", "vat110", "vat120"}
+	PaymentMethods	= []string{"full_prepayment", "prepayment", "advance", "full_payment", "partial_payment", "credit", "credit_payment"}
+	PaymentObjects	= []string{"commodity", "excise", "job", "service", "gambling_bet", "gambling_prize", "lottery", "lottery_prize", "intellectual_activity", "payment", "agent_commission", "composite", "another"}
+)
+
+// ReceiptItem is a fiscal receipt line, amounts are in minor units like the order amount.
+type ReceiptItem struct {
+	Name					string 		`json:"name"`
+	Price					int64 		`json:"price"`			// price per unit
+	Quantity				float64 	`json:"quantity"`
+	Sum					int64 		`json:"sum"`			// price * quantity
+	MeasurementUnit				string 		`json:"measurement_unit,omitempty"`
+	PaymentMethod				string 		`json:"payment_method"`		// one of PaymentMethods
+	PaymentObject				string 		`json:"payment_object"`		// one of PaymentObjects
+	Vat					string 		`json:"vat"`			// one of VatRates
+}
+
+// Receipt is fiscal data sent to ATOL with Checkout or Capture.
+type Receipt struct {
+	Items					[]ReceiptItem	`json:"items"`
+	Email					string 		`json:"email,omitempty"`	// customer contact, email or phone is required
+	Phone					string 		`json:"phone,omitempty"`
+	Sno					string 		`json:"sno,omitempty"`		// taxation system: osn, usn_income, usn_income_outcome, envd, esn, patent
+}
+
+func (r *Receipt) Total() int64 {
+	var total int64
+	for _, item := range r.Items {
+		total += item.Sum
+	}
+	return total
+}
+
+func oneOf(value string, allowed []string) bool {
+	for _, v := range allowed {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks receipt items and that they add up to amount.
+func (r *Receipt) Validate(amount int64) error {
+	if len(r.Items) == 0 {
+		return errors.New("Receipt has no items")
+	}
+	if r.Email == "" && r.Phone == "" {
+		return errors.New("Receipt requires customer email or phone")
+	}
+	for i, item := range r.Items {
+		switch {
+		case item.Name == "" || len([]rune(item.Name)) > 128:
+			return errors.New(fmt.Sprintf("Receipt item %d: name must be 1-128 characters", i))
+		case item.Price < 0 || item.Quantity <= 0:
+			return errors.New(fmt.Sprintf("Receipt item %d: price and quantity must be positive", i))
+		case item.Sum != int64(math.Round(float64(item.Price) * item.Quantity)):
+			return errors.New(fmt.Sprintf("Receipt item %d: sum %d != price %d * quantity %v", i, item.Sum, item.Price, item.Quantity))
+		case !oneOf(item.Vat, VatRates):
+			return errors.New(fmt.Sprintf("Receipt item %d: unknown vat %q", i, item.Vat))
+		case !oneOf(item.PaymentMethod, PaymentMethods):
+			return errors.New(fmt.Sprintf("Receipt item %d: unknown payment method %q", i, item.PaymentMethod))
+		case !oneOf(item.PaymentObject, PaymentObjects):
+			return errors.New(fmt.Sprintf("Receipt item %d: unknown payment object %q", i, item.PaymentObject))
+		}
+	}
+	if total := r.Total(); total != amount {
+		return errors.New(fmt.Sprintf("Receipt total %d != order amount %d", total, amount))
+	}
+	return nil
+}
+
+// ReceiptBuilder collects receipt items, see NewReceipt.
+type ReceiptBuilder struct {
+	receipt		Receipt
+	method		string
+	object		string
+}
+
+// NewReceipt starts a receipt, items are full_payment of commodity unless changed.
+func NewReceipt() *ReceiptBuilder {
+	return &ReceiptBuilder{method: "full_payment", object: "commodity"}
+}
+
+func (b *ReceiptBuilder) Customer(email, phone string) *ReceiptBuilder {
+	b.receipt.Email, b.receipt.Phone = email, phone
+	return b
+}
+
+func (b *ReceiptBuilder) Taxation(sno string) *ReceiptBuilder {
+	b.receipt.Sno = sno
+	return b
+}
+
+// Payment sets payment method and object for the items added after it.
+func (b *ReceiptBuilder) Payment(method, object string) *ReceiptBuilder {
+	b.method, b.object = method, object
+	return b
+}
+
+// Item adds a line, its sum is computed from price and quantity.
+func (b *ReceiptBuilder) Item(name string, price int64, quantity float64, vat string) *ReceiptBuilder {
+	return b.Add(ReceiptItem{Name: name, Price: price, Quantity: quantity, Vat: vat})
+}
+
+// Add adds a line as is, filling empty sum, payment method and object.
+func (b *ReceiptBuilder) Add(item ReceiptItem) *ReceiptBuilder {
+	if item.Sum == 0 {
+		item.Sum = int64(math.Round(float64(item.Price) * item.Quantity))
+	}
+	if item.PaymentMethod == "" {
+		item.PaymentMethod = b.method
+	}
+	if item.PaymentObject == "" {
+		item.PaymentObject = b.object
+	}
+	b.receipt.Items = append(b.receipt.Items, item)
+	return b
+}
+
+func (b *ReceiptBuilder) Build() *Receipt {
+	receipt := b.receipt
+	receipt.Items = append([]ReceiptItem(nil), b.receipt.Items...)
+	return &receipt
+}
+
+// SetReceipt validates the receipt against the checkout amount and attaches it.
+func (c *Checkout) SetReceipt(r *Receipt) error {
+	if err := r.Validate(c.Amount); err != nil {
+		return err
+	}
+	c.ReceiptData = r
+	return nil
+}
+
+// SetReceipt validates the receipt against the captured amount and attaches it.
+func (c *Capture) SetReceipt(r *Receipt) error {
+	amount, err := strconv.ParseInt(c.Amount, 10, 64)
+	if err != nil {
+		return errors.New("Capture amount is not a number: " + c.Amount)
+	}
+	if err := r.Validate(amount); err != nil {
+		return err
+	}
+	c.ReceiptData = r
+	return nil
+}
+
+// AtolLog is a fiscal receipt registration result returned by AtolLogs.
+type AtolLog struct {
+	UUID					string 		`json:"uuid"`
+	Status					string 		`json:"status"`			// wait, done, fail
+	Timestamp				string 		`json:"timestamp"`
+	Error					*struct {
+		Code				int 		`json:"code"`
+		Text				string 		`json:"text"`
+		Type				string 		`json:"type"`
+	}							`json:"error"`
+	Payload					struct {
+		Total				float64 	`json:"total"`
+		FnsSite				string 		`json:"fns_site"`
+		FnNumber			string 		`json:"fn_number"`
+		ShiftNumber			int64 		`json:"shift_number"`
+		ReceiptDatetime			string 		`json:"receipt_datetime"`
+		FiscalReceiptNumber		int64 		`json:"fiscal_receipt_number"`
+		FiscalDocumentNumber		int64 		`json:"fiscal_document_number"`
+		FiscalDocumentAttribute		int64 		`json:"fiscal_document_attribute"`
+		EcrRegistrationNumber		string 		`json:"ecr_registration_number"`
+	}							`json:"payload"`
+}
+
+// ParseAtolLogs converts the AtolLogs result, a single log or a list of them, into typed logs.
+func ParseAtolLogs(v interface{}) ([]AtolLog, error) {
+	output, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []AtolLog
+	switch v.(type) {
+	case []interface{}:
+		err = json.Unmarshal(output, &logs)
+	case nil:
+	default:
+		var log AtolLog
+		err = json.Unmarshal(output, &log)
+		logs = append(logs, log)
+	}
+	return logs, err
+}
+
+// AtolReceipts is AtolLogs parsed into typed logs.
+func (a *Api) AtolReceipts(orderID string) ([]AtolLog, error) {
+	order, err := a.AtolLogs(orderID)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAtolLogs(order)
+}
@@ -0,0 +1,77 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestReceipt(t *testing.T) {
+	receipt := NewReceipt().
+		Customer("buyer@example.com", "").
+		Item("Book", 1000, 2, "vat10").
+		Payment("full_payment", "service").
+		Item("Delivery", 333, 1.5, "vat20").
+		Build()
+
+	if receipt.Items[1].Sum != 500 || receipt.Items[1].PaymentObject != "service" || receipt.Items[0].PaymentObject != "commodity" {
+		t.Errorf("unexpected items: %v", receipt.Items)
+	}
+
+	checkout := &Checkout{OrderID: "1", Amount: 2400, Currency: "RUB"}
+	if err := checkout.SetReceipt(receipt); err == nil {
+		t.Error("wrong total is accepted")
+	}
+	checkout.Amount = 2500
+	if err := checkout.SetReceipt(receipt); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	data, err := a.orderData(checkout)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	raw, err := base64.StdEncoding.DecodeString(data["receipt_data"].(string))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var decoded Receipt
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Total() != 2500 || decoded.Email != "buyer@example.com" {
+		t.Errorf("unexpected receipt_data: %s", raw)
+	}
+
+	for name, item := range map[string]ReceiptItem{
+		"vat": {Name: "x", Price: 100, Quantity: 1, Sum: 100, Vat: "vat18", PaymentMethod: "full_payment", PaymentObject: "commodity"},
+		"sum": {Name: "x", Price: 100, Quantity: 2, Sum: 100, Vat: "vat20", PaymentMethod: "full_payment", PaymentObject: "commodity"},
+		"method": {Name: "x", Price: 100, Quantity: 1, Sum: 100, Vat: "vat20", PaymentMethod: "cash", PaymentObject: "commodity"},
+	} {
+		r := &Receipt{Items: []ReceiptItem{item}, Phone: "+70000000000"}
+		if err := r.Validate(item.Sum); err == nil {
+			t.Errorf("%s: invalid item is accepted", name)
+		}
+	}
+
+	capture := &Capture{OrderID: "1", Amount: "2500", Currency: "RUB"}
+	if err := capture.SetReceipt(&Receipt{Items: receipt.Items}); err == nil {
+		t.Error("receipt without customer contact is accepted")
+	}
+}
+
+func TestParseAtolLogs(t *testing.T) {
+	var order interface{}
+	json.Unmarshal([]byte(`[{"uuid": "u1", "status": "done", "payload": {"total": 25, "fiscal_receipt_number": 7}}, {"uuid": "u2", "status": "fail", "error": {"code": 32, "text": "bad"}}]`), &order)
+
+	logs, err := ParseAtolLogs(order)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(logs) != 2 || logs[0].Payload.FiscalReceiptNumber != 7 || logs[1].Error == nil || logs[1].Error.Code != 32 {
+		t.Errorf("unexpected logs: %+v", logs)
+	}
+
+	json.Unmarshal([]byte(`{"uuid": "u3", "status": "wait"}`), &order)
+	if logs, err := ParseAtolLogs(order); err != nil || len(logs) != 1 || logs[0].Status != "wait" {
+		t.Errorf("unexpected logs: %+v %v", logs, err)
+	}
+}
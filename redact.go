@@ -0,0 +1,88 @@
+package fondy
+
+import (
+	"github.com/srostyslav/fondy/card"
+	"strconv"
+	"strings"
+	"fmt"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields maps payload keys to the way they are scrubbed before logging.
+var sensitiveFields = map[string]func(string) (string, bool){
+	"card_number":		maskField,
+	"receiver_card_number":	maskField,
+	"masked_card":		maskField,
+	"cvv2":			dropField,
+	"expiry_date":		redactField,
+	"rectoken":		redactField,
+	"receiver_rectoken":	redactField,
+}
+
+func maskField(v string) (string, bool) { return MaskPAN(v), true }
+func redactField(v string) (string, bool) { return redacted, true }
+func dropField(v string) (string, bool) { return "", false }
+
+// MaskPAN keeps BIN and last four digits of a card number, e.g. 444455******1111.
+func MaskPAN(pan string) string {
+	return card.Mask(pan)
+}
+
+// Redact returns a copy of the payload safe to log: card numbers are masked,
+// CVV is dropped, rectokens and any occurrence of the secret keys are scrubbed.
+// A SensitiveString under any other key is replaced with [REDACTED].
+func Redact(payload map[string]interface{}, secrets ...string) map[string]interface{} {
+	output := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		if fn, ok := sensitiveFields[k]; ok {
+			value := ""
+			if s, ok := v.(SensitiveString); ok {
+				value = s.masked()
+			} else {
+				value = toString(v)
+			}
+			if value, keep := fn(value); keep {
+				output[k] = value
+			}
+			continue
+		}
+		output[k] = redactValue(v, secrets...)
+	}
+	return output
+}
+
+func redactValue(v interface{}, secrets ...string) interface{} {
+	switch value := v.(type) {
+	case SensitiveString:
+		return value.String()
+	case map[string]interface{}:
+		return Redact(value, secrets...)
+	case []interface{}:
+		output := make([]interface{}, len(value))
+		for i, item := range value {
+			output[i] = redactValue(item, secrets...)
+		}
+		return output
+	case string:
+		for _, secret := range secrets {
+			if secret != "" {
+				value = strings.Replace(value, secret, redacted, -1)
+			}
+		}
+		return value
+	}
+	return v
+}
+
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
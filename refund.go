@@ -0,0 +1,331 @@
+package fondy
+
+import (
+	"github.com/satori/go.uuid"
+	"strconv"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"fmt"
+)
+
+var (
+	ErrRefundExceedsBalance	= errors.New("Refund exceeds refundable balance")
+	ErrRefundNotFound	= errors.New("Refund is not found")
+)
+
+const (
+	RefundDeclined		= "declined"	// Fondy declined the reversal transaction
+	RefundRejected		= "rejected"	// Fondy refused the request, no transaction was made
+)
+
+// Refund is a reversal made through RefundManager, amounts are in minor units.
+type Refund struct {
+	ID					string 		`json:"id"`
+	OrderID					string 		`json:"order_id"`
+	Amount					int64 		`json:"amount"`
+	Currency				string 		`json:"currency"`
+	Reason					string 		`json:"reason"`
+	Operator				string 		`json:"operator"`
+	Status					string 		`json:"reverse_status"`
+	Error					string 		`json:"error,omitempty"`
+	CreatedAt				time.Time	`json:"created_at"`
+}
+
+// counts tells whether the refund takes money from the balance. A pending one does too and so
+// does one whose Reverse call got no answer, it may have gone through until it is resolved.
+func (r Refund) counts() bool {
+	return r.Status != RefundDeclined && r.Status != RefundRejected
+}
+
+// unknown tells whether the outcome of the refund is not known, its Reverse call got no answer.
+func (r Refund) unknown() bool {
+	return r.Error != "" && r.Status == ""
+}
+
+// rejected tells whether Fondy refused the reversal request, so nothing was reversed.
+// Transport errors, timeouts and 5xx responses leave the outcome unknown.
+func rejected(err error) bool {
+	var (
+		apiErr	*ApiError
+		resp	*ResponseError
+	)
+	if errors.As(err, &apiErr) {
+		return true
+	}
+	return errors.As(err, &resp) && resp.Err == nil && resp.StatusCode >= 400 && resp.StatusCode < 500
+}
+
+type RefundStore interface {
+	Refunds(orderID string) ([]Refund, error)
+	Add(refund Refund) error
+	Update(refund Refund) error	// replaces the refund with the same OrderID and ID
+}
+
+type MemoryRefundStore struct {
+	mu		sync.Mutex
+	refunds		map[string][]Refund
+}
+
+func (s *MemoryRefundStore) Refunds(orderID string) ([]Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Refund(nil), s.refunds[orderID]...), nil
+}
+
+func (s *MemoryRefundStore) Add(refund Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refunds == nil {
+		s.refunds = map[string][]Refund{}
+	}
+	s.refunds[refund.OrderID] = append(s.refunds[refund.OrderID], refund)
+	return nil
+}
+
+func (s *MemoryRefundStore) Update(refund Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.refunds[refund.OrderID] {
+		if r.ID == refund.ID {
+			s.refunds[refund.OrderID][i] = refund
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrRefundNotFound, refund.ID)
+}
+
+type RefundBalance struct {
+	OrderID					string 		`json:"order_id"`
+	Currency				string 		`json:"currency"`
+	Captured				int64 		`json:"captured"`
+	Refunded				int64 		`json:"refunded"`
+	Refundable				int64 		`json:"refundable"`
+	Refunds					[]Refund	`json:"refunds"`
+}
+
+// RefundManager validates partial refunds against what was captured and already refunded.
+type RefundManager struct {
+	Api		*Api
+	Store		RefundStore	// in memory when nil
+
+	mu		sync.Mutex
+	orders		map[string]*sync.Mutex
+}
+
+func NewRefundManager(api *Api, store RefundStore) *RefundManager {
+	if store == nil {
+		store = &MemoryRefundStore{}
+	}
+	return &RefundManager{Api: api, Store: store, orders: map[string]*sync.Mutex{}}
+}
+
+func (m *RefundManager) lock(orderID string) func() {
+	m.mu.Lock()
+	l, ok := m.orders[orderID]
+	if !ok {
+		l = &sync.Mutex{}
+		m.orders[orderID] = l
+	}
+	m.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// parseAmount reads an amount in minor units, a missing one is 0.
+func parseAmount(v interface{}) (int64, error) {
+	s := strings.TrimSpace(toString(v))
+	if s == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Amount is not in minor units: %q", s))
+	}
+	return value, nil
+}
+
+// Balance computes the refundable balance from GetOrderStatus, TransactionList and recorded refunds.
+func (m *RefundManager) Balance(orderID string) (*RefundBalance, error) {
+	order, err := m.Api.GetOrderStatus(orderID)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := m.Api.TransactionList(orderID)
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := m.Store.Refunds(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &RefundBalance{OrderID: orderID, Currency: toString(order["currency"]), Refunds: refunds}
+
+	var purchased, captured, reversed int64
+	declined := map[int64]int{}
+	for _, tr := range transactions {
+		amount, err := parseAmount(tr["amount"])
+		if err != nil {
+			return nil, err
+		}
+		if status := toString(tr["transaction_status"]); status != "approved" {
+			if status == "declined" && toString(tr["tran_type"]) == "reverse" {
+				declined[amount]++
+			}
+			continue
+		}
+		switch toString(tr["tran_type"]) {
+		case "purchase":
+			purchased += amount
+		case "capture":
+			captured += amount
+		case "reverse":
+			reversed += amount
+		}
+	}
+
+	balance.Captured = captured
+	if captured == 0 && toString(order["preauth"]) != "Y" {
+		balance.Captured = purchased
+	}
+	if balance.Captured == 0 && toString(order["order_status"]) == "approved" && len(transactions) == 0 {
+		if balance.Captured, err = parseAmount(order["amount"]); err != nil {
+			return nil, err
+		}
+	}
+
+	// declined reversals not matched by a known decline resolve refunds of unknown outcome
+	for _, r := range refunds {
+		if r.Status == RefundDeclined && declined[r.Amount] > 0 {
+			declined[r.Amount]--
+		}
+	}
+	for i, r := range refunds {
+		if r.unknown() && declined[r.Amount] > 0 {
+			declined[r.Amount]--
+			refunds[i].Status = RefundDeclined
+			if err := m.Store.Update(refunds[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var recorded int64
+	for _, r := range refunds {
+		if r.counts() {
+			recorded += r.Amount
+		}
+	}
+
+	// Fondy may not list a refund yet or may list refunds made outside of the manager
+	balance.Refunded = reversed
+	reversal, err := parseAmount(order["reversal_amount"])
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range []int64{reversal, recorded} {
+		if v > balance.Refunded {
+			balance.Refunded = v
+		}
+	}
+
+	if balance.Refundable = balance.Captured - balance.Refunded; balance.Refundable < 0 {
+		balance.Refundable = 0
+	}
+	return balance, nil
+}
+
+// Refund reverses amount of the order if the balance allows it and records who did it and why.
+func (m *RefundManager) Refund(orderID string, amount int64, reason, operator string) (*Refund, error) {
+	if amount <= 0 {
+		return nil, errors.New("Refund amount must be positive")
+	}
+	if reason == "" || operator == "" {
+		return nil, errors.New("Refund reason and operator are required")
+	}
+
+	unlock := m.lock(orderID)
+	defer unlock()
+
+	balance, err := m.Balance(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if amount > balance.Refundable {
+		return nil, fmt.Errorf("%w: %d > %d", ErrRefundExceedsBalance, amount, balance.Refundable)
+	}
+
+	refund := Refund{
+		ID: uuid.NewV4().String(),
+		OrderID: orderID,
+		Amount: amount,
+		Currency: balance.Currency,
+		Reason: reason,
+		Operator: operator,
+		CreatedAt: time.Now(),
+	}
+	refund.Status, err = m.Api.Reverse(&Reverse{
+		OrderID: orderID,
+		Amount: strconv.FormatInt(amount, 10),
+		Currency: balance.Currency,
+		Comment: reason,
+	})
+	if err != nil {
+		refund.Error = err.Error()
+		if rejected(err) {
+			refund.Status = RefundRejected
+		}
+	}
+	if serr := m.Store.Add(refund); serr != nil && err == nil {
+		err = serr
+	}
+	return &refund, err
+}
+
+// Resolve records the outcome of a refund whose Reverse call got no answer, once it is
+// known from Fondy reports or support. A declined or rejected refund frees its amount.
+func (m *RefundManager) Resolve(orderID, refundID, status string) (*Refund, error) {
+	if status == "" {
+		return nil, errors.New("Refund status is required")
+	}
+
+	unlock := m.lock(orderID)
+	defer unlock()
+
+	refunds, err := m.Store.Refunds(orderID)
+	if err != nil {
+		return nil, err
+	}
+	for _, refund := range refunds {
+		if refund.ID != refundID {
+			continue
+		}
+		if !refund.unknown() {
+			return nil, errors.New(fmt.Sprintf("Refund %s is already %s", refundID, refund.Status))
+		}
+		refund.Status = status
+		return &refund, m.Store.Update(refund)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrRefundNotFound, refundID)
+}
+
+// Refunded returns the cumulative amount refunded through the manager, refunds of unknown outcome included.
+func (m *RefundManager) Refunded(orderID string) (int64, error) {
+	refunds, err := m.Store.Refunds(orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, r := range refunds {
+		if r.counts() {
+			total += r.Amount
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,143 @@
+package fondy
+
+import (
+	"net/http"
+	"testing"
+	"errors"
+	"sync"
+)
+
+func TestRefundManager(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+
+	var mu sync.Mutex
+	transactions := []interface{}{
+		map[string]interface{}{"tran_type": "purchase", "transaction_status": "approved", "amount": "1000"},
+	}
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch endpoint {
+		case "status/order_id":
+			return map[string]interface{}{"order": map[string]interface{}{"order_id": order["order_id"], "order_status": "approved", "amount": "1000", "currency": "UAH"}}
+		case "transaction_list":
+			return transactions
+		}
+		transactions = append(transactions, map[string]interface{}{"tran_type": "reverse", "transaction_status": "approved", "amount": order["amount"]})
+		return map[string]interface{}{"order": map[string]interface{}{"reverse_status": "approved"}}
+	})
+	defer server.Close()
+
+	m := NewRefundManager(a, nil)
+
+	if refund, err := m.Refund("order-1", 600, "damaged item", "alice"); err != nil {
+		t.Fatal(err.Error())
+	} else if refund.Status != "approved" || refund.Currency != "UAH" {
+		t.Errorf("unexpected refund: %+v", refund)
+	}
+
+	if _, err := m.Refund("order-1", 500, "second item", "bob"); !errors.Is(err, ErrRefundExceedsBalance) {
+		t.Errorf("expected balance error, got %v", err)
+	}
+	if _, err := m.Refund("order-1", 100, "", "bob"); err == nil {
+		t.Error("refund without reason is accepted")
+	}
+
+	if _, err := m.Refund("order-1", 400, "second item", "bob"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	balance, err := m.Balance("order-1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if balance.Captured != 1000 || balance.Refunded != 1000 || balance.Refundable != 0 || len(balance.Refunds) != 2 {
+		t.Errorf("unexpected balance: %+v", balance)
+	}
+	if total, _ := m.Refunded("order-1"); total != 1000 {
+		t.Errorf("unexpected refunded total: %d", total)
+	}
+}
+
+func TestRefundManagerUnknownOutcome(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+
+	var mu sync.Mutex
+	transactions := []interface{}{
+		map[string]interface{}{"tran_type": "purchase", "transaction_status": "approved", "amount": "1000"},
+	}
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch endpoint {
+		case "status/order_id":
+			return map[string]interface{}{"order": map[string]interface{}{"order_id": order["order_id"], "order_status": "approved", "amount": "1000", "currency": "UAH"}}
+		case "transaction_list":
+			return transactions
+		}
+		return map[string]interface{}{"error_code": 1002, "error_message": "Application error"}
+	})
+	defer server.Close()
+
+	unavailable := true
+	a.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			if ex.Endpoint != "reverse/order_id" || !unavailable {
+				return next(ex)
+			}
+			ex.StatusCode, ex.Body = http.StatusBadGateway, []byte("bad gateway")
+			return ex.Decode()
+		}
+	})
+
+	m := NewRefundManager(a, nil)
+
+	unknown, err := m.Refund("order-1", 600, "damaged item", "alice")
+	if err == nil || !unknown.unknown() {
+		t.Fatalf("failed reverse is not reported: %+v %v", unknown, err)
+	}
+	if _, err := m.Refund("order-1", 600, "damaged item", "alice"); !errors.Is(err, ErrRefundExceedsBalance) {
+		t.Errorf("retry of a refund of unknown outcome is not blocked: %v", err)
+	}
+
+	mu.Lock()
+	transactions = append(transactions, map[string]interface{}{"tran_type": "reverse", "transaction_status": "declined", "amount": "600"})
+	mu.Unlock()
+
+	if balance, err := m.Balance("order-1"); err != nil || balance.Refundable != 1000 || balance.Refunds[0].Status != RefundDeclined {
+		t.Errorf("declined reverse does not resolve the refund: %+v %v", balance, err)
+	}
+	if _, err := m.Resolve("order-1", unknown.ID, "approved"); err == nil {
+		t.Error("resolved refund is resolved again")
+	}
+
+	// Fondy refuses the request: nothing is reversed and the amount stays refundable
+	unavailable = false
+	if refund, err := m.Refund("order-1", 400, "damaged item", "alice"); err == nil || refund.Status != RefundRejected {
+		t.Errorf("refused reverse is not rejected: %+v %v", refund, err)
+	}
+	if balance, err := m.Balance("order-1"); err != nil || balance.Refundable != 1000 {
+		t.Errorf("rejected refund takes the balance: %+v %v", balance, err)
+	}
+
+	unavailable = true
+	unknown, _ = m.Refund("order-1", 300, "damaged item", "alice")
+	if balance, _ := m.Balance("order-1"); balance.Refundable != 700 {
+		t.Errorf("refund of unknown outcome does not count: %+v", balance)
+	}
+	if refund, err := m.Resolve("order-1", unknown.ID, RefundDeclined); err != nil || refund.Status != RefundDeclined {
+		t.Errorf("refund is not resolved: %+v %v", refund, err)
+	}
+	if balance, _ := m.Balance("order-1"); balance.Refundable != 1000 {
+		t.Errorf("resolved refund takes the balance: %+v", balance)
+	}
+
+	mu.Lock()
+	transactions = append(transactions, map[string]interface{}{"tran_type": "capture", "transaction_status": "approved", "amount": "10.00"})
+	mu.Unlock()
+	if _, err := m.Balance("order-1"); err == nil {
+		t.Error("amount in major units is read as 0")
+	}
+}
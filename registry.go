@@ -0,0 +1,144 @@
+package fondy
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"errors"
+	"sync"
+	"fmt"
+)
+
+var ErrMerchantNotFound = errors.New("Merchant not found")
+
+// RouteFunc picks a merchant for the order payload of a request.
+type RouteFunc func(order map[string]interface{}) (int64, bool)
+
+// Registry holds apis of several merchants and routes calls and callbacks between them.
+type Registry struct {
+	mu		sync.RWMutex
+	apis		map[int64]*Api
+	routes		[]RouteFunc
+	middleware	[]Middleware
+}
+
+func NewRegistry(routes ...RouteFunc) *Registry {
+	return &Registry{apis: map[int64]*Api{}, routes: routes}
+}
+
+// Add registers an api for options.MerchantID, replacing the previous one.
+func (r *Registry) Add(options *ApiOptions) *Api {
+	if options.MerchantID == 0 || (options.SecretKey == "" && options.Keys == nil) {
+		panic("MerchantID and SecretKey or Keys are required")
+	}
+	a := NewApi(options)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a.Use(r.middleware...)
+	r.apis[options.MerchantID] = a
+	return a
+}
+
+func (r *Registry) Remove(merchantID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.apis, merchantID)
+}
+
+// Use adds middleware to every registered api and to the ones added later.
+func (r *Registry) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.middleware = append(r.middleware, middleware...)
+	for _, a := range r.apis {
+		a.Use(middleware...)
+	}
+}
+
+func (r *Registry) Get(merchantID int64) (*Api, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if a, ok := r.apis[merchantID]; ok {
+		return a, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrMerchantNotFound, merchantID)
+}
+
+// Route returns the api for a request: merchant_id of the body if set,
+// otherwise the first route function that matches.
+func (r *Registry) Route(body interface{}) (*Api, error) {
+	output, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var order map[string]interface{}
+	if err := json.Unmarshal(output, &order); err != nil {
+		return nil, err
+	}
+
+	if id, ok := merchantID(order["merchant_id"]); ok {
+		return r.Get(id)
+	}
+	for _, route := range r.routes {
+		if id, ok := route(order); ok {
+			return r.Get(id)
+		}
+	}
+	return nil, fmt.Errorf("%w: no route for order %v", ErrMerchantNotFound, order["order_id"])
+}
+
+// ParseCallback looks up the merchant of a callback and verifies it with the merchant's secret.
+func (r *Registry) ParseCallback(content []byte) (*Api, map[string]interface{}, error) {
+	_, raw, err := callbackOrder(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var order map[string]interface{}
+	if err := json.Unmarshal(raw, &order); err != nil {
+		return nil, nil, err
+	}
+
+	id, ok := merchantID(order["merchant_id"])
+	if !ok {
+		return nil, nil, errors.New("Callback merchant_id is empty")
+	}
+
+	a, err := r.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, err = a.ParseCallback(content)
+	return a, order, err
+}
+
+// ByField routes orders by a string field value, e.g. ByField("currency", map[string]int64{"UAH": 1, "EUR": 2}).
+func ByField(field string, merchants map[string]int64) RouteFunc {
+	return func(order map[string]interface{}) (int64, bool) {
+		if v, ok := order[field].(string); ok {
+			id, ok := merchants[strings.ToUpper(v)]
+			if !ok {
+				id, ok = merchants[v]
+			}
+			return id, ok
+		}
+		return 0, false
+	}
+}
+
+func merchantID(v interface{}) (int64, bool) {
+	switch id := v.(type) {
+	case float64:
+		return int64(id), id > 0
+	case string:
+		if value, err := strconv.ParseInt(id, 10, 64); err == nil && value > 0 {
+			return value, true
+		}
+	}
+	return 0, false
+}
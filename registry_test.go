@@ -0,0 +1,109 @@
+package fondy
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"context"
+	"errors"
+	"sync"
+)
+
+func signedCallback(a *Api, order map[string]interface{}) []byte {
+	data, _ := a.ToB64(map[string]interface{}{"order": order})
+	content, _ := json.Marshal(map[string]interface{}{"version": "2.0", "data": data, "signature": a.GetSignature(data)})
+	return content
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(ByField("currency", map[string]int64{"UAH": 1001, "EUR": 1002}))
+	uah := r.Add(&ApiOptions{MerchantID: 1001, SecretKey: "uah-secret"})
+	eur := r.Add(&ApiOptions{MerchantID: 1002, SecretKey: "eur-secret"})
+
+	var merchants []int64
+	r.Use(func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			merchants = append(merchants, ex.api.Options.MerchantID)
+			return next(ex)
+		}
+	})
+
+	defer fakeFondy(t, uah, checkoutReply).Close()
+	defer fakeFondy(t, eur, checkoutReply).Close()
+
+	for _, currency := range []string{"eur", "UAH"} {
+		data := &Checkout{OrderID: currency, Currency: currency, Amount: 100}
+		if a, err := r.Route(data); err != nil {
+			t.Fatal(err.Error())
+		} else if _, err := a.CheckoutUrl(data); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	if len(merchants) != 2 || merchants[0] != 1002 || merchants[1] != 1001 {
+		t.Errorf("unexpected routing: %v", merchants)
+	}
+
+	if _, err := r.Route(&Checkout{OrderID: "1", Currency: "USD"}); !errors.Is(err, ErrMerchantNotFound) {
+		t.Errorf("expected merchant not found, got %v", err)
+	}
+	if a, err := r.Route(map[string]interface{}{"merchant_id": 1001, "currency": "EUR"}); err != nil || a != uah {
+		t.Errorf("merchant_id is not preferred: %v", err)
+	}
+}
+
+func TestRegistryCallback(t *testing.T) {
+	r := NewRegistry()
+	r.Add(&ApiOptions{MerchantID: 1001, SecretKey: "uah-secret"})
+	eur := r.Add(&ApiOptions{MerchantID: 1002, SecretKey: "eur-secret"})
+
+	content := signedCallback(eur, map[string]interface{}{"merchant_id": 1002, "order_id": "1", "order_status": "approved"})
+	if a, order, err := r.ParseCallback(content); err != nil {
+		t.Fatal(err.Error())
+	} else if a != eur || order["order_status"] != "approved" {
+		t.Errorf("unexpected callback: %v", order)
+	}
+
+	forged := signedCallback(eur, map[string]interface{}{"merchant_id": 1001, "order_id": "1", "order_status": "approved"})
+	if _, _, err := r.ParseCallback(forged); !errors.Is(err, ErrSignature) {
+		t.Errorf("expected signature error, got %v", err)
+	}
+
+	unknown := signedCallback(eur, map[string]interface{}{"merchant_id": 1003, "order_id": "1"})
+	if _, _, err := r.ParseCallback(unknown); !errors.Is(err, ErrMerchantNotFound) {
+		t.Errorf("expected merchant not found, got %v", err)
+	}
+}
+
+func TestRegistryUseWhileCalling(t *testing.T) {
+	r := NewRegistry()
+	a := r.Add(&ApiOptions{MerchantID: 1001, SecretKey: "uah-secret"})
+	defer fakeFondy(t, a, checkoutReply).Close()
+
+	var calls atomic.Int64
+	count := func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			calls.Add(1)
+			return next(ex)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.WithContext(context.Background()).CheckoutUrl(&Checkout{OrderID: "1", Currency: "UAH", Amount: 100})
+		}()
+		go func() {
+			defer wg.Done()
+			r.Use(count)
+		}()
+	}
+	wg.Wait()
+
+	calls.Store(0)
+	a.CheckoutUrl(&Checkout{OrderID: "2", Currency: "UAH", Amount: 100})
+	if calls.Load() != 4 {
+		t.Errorf("unexpected middleware calls: %d", calls.Load())
+	}
+}
@@ -0,0 +1,107 @@
+package fondy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"errors"
+	"math"
+	"fmt"
+)
+
+// ReservationProduct is a cart line of reservation_data.
+type ReservationProduct struct {
+	ID					string 		`json:"id"`
+	Name					string 		`json:"name"`
+	Price					float64 	`json:"price"`
+	TotalAmount				float64 	`json:"total_amount"`
+	Quantity				int64 		`json:"quantity"`
+}
+
+// ReservationData is antifraud data sent base64 encoded as reservation_data.
+type ReservationData struct {
+	CustomerZip				string 		`json:"customer_zip,omitempty"`
+	CustomerName				string 		`json:"customer_name,omitempty"`
+	CustomerAddress				string 		`json:"customer_address,omitempty"`
+	CustomerState				string 		`json:"customer_state,omitempty"`
+	CustomerCountry				string 		`json:"customer_country,omitempty"`	// ISO 3166-1 alpha-2
+	Phonemobile				string 		`json:"phonemobile,omitempty"`
+	Account					string 		`json:"account,omitempty"`		// customer account id in the merchant system
+	Uuid					string 		`json:"uuid,omitempty"`			// device or session id
+	CmsName					string 		`json:"cms_name,omitempty"`
+	CmsVersion				string 		`json:"cms_version,omitempty"`
+	ShopDomain				string 		`json:"shop_domain,omitempty"`
+	Path					string 		`json:"path,omitempty"`
+	AccountAge				int64 		`json:"account_age,omitempty"`		// days since customer registration
+	Products				[]ReservationProduct	`json:"products,omitempty"`
+}
+
+// Validate checks the fields Fondy rejects or antifraud can not use.
+func (r *ReservationData) Validate() error {
+	if r.CustomerCountry != "" && (len(r.CustomerCountry) != 2 || strings.ToUpper(r.CustomerCountry) != r.CustomerCountry) {
+		return errors.New(fmt.Sprintf("Reservation customer_country must be ISO 3166-1 alpha-2: %q", r.CustomerCountry))
+	}
+	if r.Phonemobile != "" {
+		phone := strings.TrimPrefix(r.Phonemobile, "+")
+		if len(phone) < 10 || len(phone) > 15 || strings.Trim(phone, "0123456789") != "" {
+			return errors.New(fmt.Sprintf("Reservation phonemobile must be 10-15 digits: %q", r.Phonemobile))
+		}
+	}
+	if r.AccountAge < 0 {
+		return errors.New("Reservation account_age can not be negative")
+	}
+	for i, p := range r.Products {
+		switch {
+		case p.ID == "" || p.Name == "":
+			return errors.New(fmt.Sprintf("Reservation product %d: id and name are required", i))
+		case p.Quantity <= 0 || p.Price < 0:
+			return errors.New(fmt.Sprintf("Reservation product %d: quantity and price must be positive", i))
+		case math.Abs(p.TotalAmount - p.Price * float64(p.Quantity)) > 0.005:
+			return errors.New(fmt.Sprintf("Reservation product %d: total_amount %v != price %v * quantity %d", i, p.TotalAmount, p.Price, p.Quantity))
+		}
+	}
+	return nil
+}
+
+// SetReservation validates and attaches antifraud data to the checkout.
+func (c *Checkout) SetReservation(r *ReservationData) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	c.ReservationData = r
+	return nil
+}
+
+// SetReservation validates and attaches antifraud data to the payment.
+func (p *PCIDSSOneStep) SetReservation(r *ReservationData) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	p.ReservationData = r
+	return nil
+}
+
+// DecodeReservation decodes reservation_data echoed back in callbacks and order status.
+func DecodeReservation(v interface{}) (*ReservationData, error) {
+	var r ReservationData
+	switch value := v.(type) {
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		content, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return &r, json.Unmarshal(content, &r)
+	case map[string]interface{}:
+		output, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return &r, json.Unmarshal(output, &r)
+	case nil:
+		return nil, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unexpected reservation_data: %v", v))
+}
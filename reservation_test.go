@@ -0,0 +1,50 @@
+package fondy
+
+import (
+	"testing"
+)
+
+func TestReservationData(t *testing.T) {
+	reservation := &ReservationData{
+		CustomerName: "Ivan Petrenko",
+		CustomerCountry: "UA",
+		Phonemobile: "+380501234567",
+		Account: "customer-1",
+		AccountAge: 120,
+		Uuid: "device-1",
+		Products: []ReservationProduct{{ID: "sku-1", Name: "Book", Price: 10.5, Quantity: 2, TotalAmount: 21}},
+	}
+
+	payment := &PCIDSSOneStep{OrderID: "1", Amount: "2100"}
+	if err := payment.SetReservation(reservation); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	data, err := a.orderData(payment)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	decoded, err := DecodeReservation(data["reservation_data"])
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if decoded.CustomerName != reservation.CustomerName || len(decoded.Products) != 1 || decoded.Products[0].TotalAmount != 21 {
+		t.Errorf("unexpected round trip: %+v", decoded)
+	}
+
+	if r, err := DecodeReservation(nil); r != nil || err != nil {
+		t.Errorf("empty reservation_data: %v %v", r, err)
+	}
+
+	for name, r := range map[string]*ReservationData{
+		"country": {CustomerCountry: "Ukraine"},
+		"phone": {Phonemobile: "call me"},
+		"total": {Products: []ReservationProduct{{ID: "1", Name: "x", Price: 1, Quantity: 2, TotalAmount: 1}}},
+	} {
+		if err := (&Checkout{}).SetReservation(r); err == nil {
+			t.Errorf("%s: invalid reservation_data is accepted", name)
+		}
+	}
+}
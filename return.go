@@ -0,0 +1,209 @@
+package fondy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrReturnReplayed	= errors.New("Return redirect is replayed")
+	ErrReturnMismatch	= errors.New("Return redirect does not match the order")
+)
+
+// OrderResult is the order Fondy sends to the response url and callbacks.
+type OrderResult struct {
+	OrderID					string 		`json:"order_id"`
+	OrderStatus				string 		`json:"order_status"`
+	ResponseStatus				string 		`json:"response_status"`
+	PaymentID				json.Number	`json:"payment_id"`
+	Amount					json.Number	`json:"amount"`
+	ActualAmount				json.Number	`json:"actual_amount"`
+	Currency				string 		`json:"currency"`
+	ActualCurrency				string 		`json:"actual_currency"`
+	MaskedCard				string 		`json:"masked_card"`
+	CardType				string 		`json:"card_type"`
+	TranType				string 		`json:"tran_type"`
+	ApprovalCode				string 		`json:"approval_code"`
+	ResponseCode				json.Number	`json:"response_code"`
+	ResponseDescription			string 		`json:"response_description"`
+	SenderEmail				string 		`json:"sender_email"`
+	MerchantData				string 		`json:"merchant_data"`
+	OrderTime				string 		`json:"order_time"`
+	Verified				bool		`json:"-"`	// order status is confirmed with GetOrderStatus
+}
+
+// Outcome groups order statuses into "success", "failure" and "pending".
+func (o *OrderResult) Outcome() string {
+	switch o.OrderStatus {
+	case "approved":
+		return "success"
+	case "declined", "expired", "reversed":
+		return "failure"
+	}
+	return "pending"
+}
+
+// ReplayGuard remembers redirects already handled.
+type ReplayGuard interface {
+	// Claim returns false if id was claimed before and has not expired.
+	Claim(id string, expires time.Time) (bool, error)
+}
+
+// MemoryReplayGuard keeps claims in memory. Claims are queued in the order they are made,
+// which is expiry order for a fixed window, so each Claim only prunes the expired head.
+type MemoryReplayGuard struct {
+	mu		sync.Mutex
+	seen		map[string]time.Time
+	queue		[]claim
+}
+
+type claim struct {
+	id		string
+	expires		time.Time
+}
+
+func (g *MemoryReplayGuard) Claim(id string, expires time.Time) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if g.seen == nil {
+		g.seen = map[string]time.Time{}
+	}
+	for len(g.queue) > 0 && !now.Before(g.queue[0].expires) {
+		// the id may have been claimed again since, only an expired claim is forgotten
+		if until, ok := g.seen[g.queue[0].id]; ok && !now.Before(until) {
+			delete(g.seen, g.queue[0].id)
+		}
+		g.queue = g.queue[1:]
+	}
+
+	if until, ok := g.seen[id]; ok && now.Before(until) {
+		return false, nil
+	}
+	g.seen[id] = expires
+	g.queue = append(g.queue, claim{id: id, expires: expires})
+	return true, nil
+}
+
+// ReturnHandler serves Checkout.ResponseUrl. It verifies the signed order the
+// browser brings back, rejects replays, optionally confirms the status with
+// GetOrderStatus and renders the page of the outcome.
+type ReturnHandler struct {
+	Api		*Api
+	Verify		bool				// confirm order status with GetOrderStatus
+	Guard		ReplayGuard			// in memory when nil
+	ReplayWindow	time.Duration			// how long a redirect is remembered, 24 hours by default
+	Success		func(w http.ResponseWriter, r *http.Request, order *OrderResult)
+	Failure		func(w http.ResponseWriter, r *http.Request, order *OrderResult)
+	Pending		func(w http.ResponseWriter, r *http.Request, order *OrderResult)
+	Error		func(w http.ResponseWriter, r *http.Request, err error)	// invalid, tampered or replayed redirects, 400 by default
+
+	once		sync.Once
+}
+
+func (h *ReturnHandler) guard() ReplayGuard {
+	h.once.Do(func() {
+		if h.Guard == nil {
+			h.Guard = &MemoryReplayGuard{}
+		}
+	})
+	return h.Guard
+}
+
+// returnBody reads a 2.0 redirect posted as a form or as json.
+func returnBody(r *http.Request) ([]byte, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return io.ReadAll(r.Body)
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	body := map[string]string{}
+	for _, field := range []string{"data", "signature", "response_status"} {
+		if v := r.PostForm.Get(field); v != "" {
+			body[field] = v
+		}
+	}
+	return json.Marshal(body)
+}
+
+func (h *ReturnHandler) order(r *http.Request) (*OrderResult, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, 64 << 10)
+	content, err := returnBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body, raw, err := callbackOrder(content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.Api.verifyBody("return", body); err != nil {
+		return nil, err
+	}
+
+	order := &OrderResult{}
+	if err := json.Unmarshal(raw, order); err != nil {
+		return nil, err
+	}
+
+	if h.Verify {
+		status, err := h.Api.WithContext(r.Context()).GetOrderStatus(order.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		if toString(status["amount"]) != order.Amount.String() || toString(status["currency"]) != order.Currency {
+			return nil, fmt.Errorf("%w: order %s", ErrReturnMismatch, order.OrderID)
+		}
+		order.OrderStatus, order.Verified = toString(status["order_status"]), true
+	}
+
+	window := h.ReplayWindow
+	if window == 0 {
+		window = 24 * time.Hour
+	}
+	if ok, err := h.guard().Claim(toString(body["signature"]), time.Now().Add(window)); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("%w: order %s", ErrReturnReplayed, order.OrderID)
+	}
+	return order, nil
+}
+
+func (h *ReturnHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, err := h.order(r)
+	if err != nil {
+		if h.Error != nil {
+			h.Error(w, r, err)
+		} else {
+			http.Error(w, "Invalid payment redirect", http.StatusBadRequest)
+		}
+		return
+	}
+
+	render := h.Pending
+	switch order.Outcome() {
+	case "success":
+		render = h.Success
+	case "failure":
+		render = h.Failure
+	}
+	if render == nil {
+		http.Error(w, "Payment is " + order.OrderStatus, http.StatusOK)
+		return
+	}
+	render(w, r, order)
+}
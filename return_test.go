@@ -0,0 +1,113 @@
+package fondy
+
+import (
+	"net/http/httptest"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"errors"
+	"time"
+)
+
+func returnForm(a *Api, order map[string]interface{}) string {
+	var body map[string]string
+	json.Unmarshal(signedCallback(a, order), &body)
+	return url.Values{"data": {body["data"]}, "signature": {body["signature"]}}.Encode()
+}
+
+func TestReturnHandler(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		return map[string]interface{}{"order": map[string]interface{}{
+			"order_id": order["order_id"],
+			"order_status": "approved",
+			"amount": "100",
+			"currency": "UAH",
+		}}
+	})
+	defer server.Close()
+
+	var pages []string
+	var errs []error
+	h := &ReturnHandler{
+		Api: a,
+		Success: func(w http.ResponseWriter, r *http.Request, order *OrderResult) {
+			pages = append(pages, "success:" + order.OrderID + ":" + order.Amount.String())
+		},
+		Failure: func(w http.ResponseWriter, r *http.Request, order *OrderResult) {
+			pages = append(pages, "failure:" + order.OrderID)
+		},
+		Pending: func(w http.ResponseWriter, r *http.Request, order *OrderResult) {
+			pages = append(pages, "pending:" + order.OrderID)
+		},
+		Error: func(w http.ResponseWriter, r *http.Request, err error) {
+			errs = append(errs, err)
+			w.WriteHeader(http.StatusBadRequest)
+		},
+	}
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/return", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	approved := returnForm(a, map[string]interface{}{"order_id": "1", "order_status": "approved", "amount": 100, "currency": "UAH"})
+	post(approved)
+	post(returnForm(a, map[string]interface{}{"order_id": "2", "order_status": "declined"}))
+	post(returnForm(a, map[string]interface{}{"order_id": "3", "order_status": "processing"}))
+
+	if code := post(approved); code != http.StatusBadRequest || len(errs) != 1 || !errors.Is(errs[0], ErrReturnReplayed) {
+		t.Errorf("replay is accepted: %d %v", code, errs)
+	}
+
+	other := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "attacker"})
+	post(returnForm(other, map[string]interface{}{"order_id": "4", "order_status": "approved"}))
+	if len(errs) != 2 || !errors.Is(errs[1], ErrSignature) {
+		t.Errorf("tampered redirect is accepted: %v", errs)
+	}
+
+	expected := []string{"success:1:100", "failure:2", "pending:3"}
+	if strings.Join(pages, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected pages: %v", pages)
+	}
+
+	h.Verify, pages = true, nil
+	post(returnForm(a, map[string]interface{}{"order_id": "5", "order_status": "processing", "amount": "100", "currency": "UAH"}))
+	post(returnForm(a, map[string]interface{}{"order_id": "6", "order_status": "approved", "amount": "1", "currency": "UAH"}))
+	if len(pages) != 1 || pages[0] != "success:5:100" || len(errs) != 3 || !errors.Is(errs[2], ErrReturnMismatch) {
+		t.Errorf("order is not verified: %v %v", pages, errs)
+	}
+}
+
+func TestMemoryReplayGuard(t *testing.T) {
+	g := &MemoryReplayGuard{}
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		g.Claim(strconv.Itoa(i), now.Add(-time.Second))
+	}
+	if ok, _ := g.Claim("a", now.Add(time.Hour)); !ok {
+		t.Error("new redirect is rejected")
+	}
+	if len(g.seen) != 1 || len(g.queue) != 1 {
+		t.Errorf("expired claims are kept: %d %d", len(g.seen), len(g.queue))
+	}
+	if ok, _ := g.Claim("a", now.Add(time.Hour)); ok {
+		t.Error("replayed redirect is accepted")
+	}
+
+	// an expired claim made again is not forgotten with its first queue entry
+	g = &MemoryReplayGuard{}
+	g.Claim("b", now.Add(-time.Second))
+	g.Claim("b", now.Add(time.Hour))
+	g.Claim("c", now.Add(time.Hour))
+	if ok, _ := g.Claim("b", now.Add(time.Hour)); ok {
+		t.Error("reclaimed redirect is accepted again")
+	}
+}
@@ -0,0 +1,156 @@
+package fondy
+
+import (
+	"github.com/srostyslav/fondy/card"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"fmt"
+)
+
+// SensitiveString holds card data like a PAN or CVV. It prints as [REDACTED]
+// with every fmt verb, in slog and in json, and is written in clear only into
+// the signed request. Wipe zeroes it once the call is done.
+type SensitiveString struct {
+	b	[]byte
+}
+
+var sensitiveType = reflect.TypeOf(SensitiveString{})
+
+// Sensitive copies s into a SensitiveString. The string itself cannot be
+// zeroed, prefer SensitiveBytes for data read into a buffer.
+func Sensitive(s string) SensitiveString {
+	return SensitiveString{b: []byte(s)}
+}
+
+// SensitiveBytes takes ownership of b, Wipe zeroes it.
+func SensitiveBytes(b []byte) SensitiveString {
+	return SensitiveString{b: b}
+}
+
+func (s SensitiveString) IsZero() bool {
+	return len(s.b) == 0
+}
+
+func (s SensitiveString) Len() int {
+	return len(s.b)
+}
+
+// Reveal returns the value in clear, the copy it makes is not wiped.
+func (s SensitiveString) Reveal() string {
+	return string(s.b)
+}
+
+// copy returns a SensitiveString with its own buffer, wiping one leaves the other intact.
+func (s SensitiveString) copy() SensitiveString {
+	if s.IsZero() {
+		return SensitiveString{}
+	}
+	return SensitiveString{b: append([]byte(nil), s.b...)}
+}
+
+// masked is the value masked as a card number, made without a clear copy.
+func (s SensitiveString) masked() string {
+	return card.MaskBytes(s.b)
+}
+
+// Wipe zeroes the value, copies of the SensitiveString share it and are wiped too.
+func (s *SensitiveString) Wipe() {
+	clear(s.b)
+	s.b = nil
+}
+
+func (s SensitiveString) String() string {
+	if s.IsZero() {
+		return ""
+	}
+	return redacted
+}
+
+func (s SensitiveString) GoString() string {
+	return fmt.Sprintf("fondy.SensitiveString(%q)", s.String())
+}
+
+func (s SensitiveString) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'q':
+		fmt.Fprintf(f, "%q", s.String())
+	case 'v':
+		if f.Flag('#') {
+			f.Write([]byte(s.GoString()))
+			return
+		}
+		fallthrough
+	default:
+		f.Write([]byte(s.String()))
+	}
+}
+
+func (s SensitiveString) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// MarshalJSON redacts the value, the request encoder writes it in clear itself.
+func (s SensitiveString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *SensitiveString) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*s = Sensitive(value)
+	return nil
+}
+
+// clearText writes a SensitiveString in clear into the signed request.
+type clearText []byte
+
+func (c clearText) MarshalJSON() ([]byte, error) {
+	output := make([]byte, 0, len(c) + 2)
+	output = append(output, '"')
+	for _, b := range c {
+		switch {
+		case b == '"' || b == '\\':
+			output = append(output, '\\', b)
+		case b < 0x20:
+			output = append(output, fmt.Sprintf("\\u%04x", b)...)
+		default:
+			output = append(output, b)
+		}
+	}
+	return append(output, '"'), nil
+}
+
+// revealOrder returns data with SensitiveString values in clear for encoding,
+// data itself is returned when it has none.
+func revealOrder(data map[string]interface{}) map[string]interface{} {
+	var output map[string]interface{}
+	for k, v := range data {
+		if s, ok := v.(SensitiveString); ok {
+			if output == nil {
+				output = make(map[string]interface{}, len(data))
+				for k, v := range data {
+					output[k] = v
+				}
+			}
+			output[k] = clearText(s.b)
+		}
+	}
+	if output == nil {
+		return data
+	}
+	return output
+}
+
+// Wipe zeroes the card number and CVV.
+func (d *PCIDSSOneStep) Wipe() {
+	d.CardNumber.Wipe()
+	d.Cvv2.Wipe()
+}
+
+// Wipe zeroes the receiver card number.
+func (d *P2Pcredit) Wipe() {
+	d.ReceiverCardNumber.Wipe()
+}
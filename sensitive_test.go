@@ -0,0 +1,85 @@
+package fondy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"bytes"
+	"fmt"
+)
+
+func TestSensitiveString(t *testing.T) {
+	order := &PCIDSSOneStep{OrderID: "1", CardNumber: Sensitive("4444555566661111"), Cvv2: Sensitive("123"), ExpiryDate: "1230"}
+
+	var logs bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("order", "card", order.CardNumber, "order", order)
+	output, _ := json.Marshal(order)
+
+	for _, s := range []string{
+		fmt.Sprint(order.CardNumber),
+		fmt.Sprintf("%v %+v %#v %s %q %x", order, order, order, order.CardNumber, order.Cvv2, order.CardNumber),
+		order.CardNumber.GoString(),
+		logs.String(),
+		string(output),
+	} {
+		if strings.Contains(s, "4444555566661111") || strings.Contains(s, "123") && !strings.Contains(s, "1230") {
+			t.Errorf("card data is printed: %s", s)
+		}
+		if !strings.Contains(s, redacted) {
+			t.Errorf("card data is not redacted: %s", s)
+		}
+	}
+
+	var decoded PCIDSSOneStep
+	json.Unmarshal([]byte(`{"card_number": "4444555566661111"}`), &decoded)
+	if decoded.CardNumber.Reveal() != "4444555566661111" {
+		t.Error("card number is not decoded")
+	}
+
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	var sent map[string]interface{}
+	server := fakeFondy(t, a, func(endpoint string, o map[string]interface{}) interface{} {
+		sent = o
+		return map[string]interface{}{"order": map[string]interface{}{"response_status": "success"}}
+	})
+	defer server.Close()
+
+	if _, err := a.PcidssStep1(order); err != nil {
+		t.Fatal(err.Error())
+	}
+	if sent["card_number"] != "4444555566661111" || sent["cvv2"] != "123" {
+		t.Errorf("card data is not sent in clear: %v", sent)
+	}
+
+	shared := order.CardNumber
+	order.Wipe()
+	if !order.CardNumber.IsZero() || !order.Cvv2.IsZero() || shared.Reveal() != strings.Repeat("\x00", 16) {
+		t.Error("card data is not wiped")
+	}
+}
+
+func TestSensitiveStringRedact(t *testing.T) {
+	payload := map[string]interface{}{
+		"pan": Sensitive("4444555566661111"),
+		"card_number": Sensitive("4444555566661111"),
+		"cvv2": Sensitive("123"),
+		"nested": map[string]interface{}{"token": Sensitive("4444555566661111")},
+		"list": []interface{}{Sensitive("4444555566661111")},
+	}
+
+	output := Redact(payload)
+	if output["pan"] != redacted || output["card_number"] != "444455******1111" || output["list"].([]interface{})[0] != redacted {
+		t.Errorf("unexpected redaction: %v", output)
+	}
+	if _, ok := output["cvv2"]; ok {
+		t.Errorf("cvv is not dropped: %v", output)
+	}
+
+	var logs bytes.Buffer
+	ex := &Exchange{Order: payload, api: NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})}
+	slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})).Debug("call", "exchange", ex)
+	if s := fmt.Sprint(output) + logs.String(); strings.Contains(s, "4444555566661111") {
+		t.Errorf("card data is logged: %s", s)
+	}
+}
@@ -0,0 +1,85 @@
+package fondy
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrSignature		= errors.New("Invalid signature")
+	ErrSignatureMissing	= errors.New("Signature is missing")
+	ErrSignatureMalformed	= errors.New("Signature is malformed")
+	ErrSignatureMismatch	= errors.New("Signature does not match")
+)
+
+// SignatureError is returned when a response or callback fails verification.
+// It matches ErrSignature and one of ErrSignatureMissing, ErrSignatureMalformed
+// or ErrSignatureMismatch with errors.Is.
+type SignatureError struct {
+	Err		error
+	Signature	string		// received signature
+	Detail		string
+}
+
+func (e *SignatureError) Error() string {
+	if e.Detail != "" {
+		return e.Err.Error() + ": " + e.Detail
+	}
+	return e.Err.Error()
+}
+
+func (e *SignatureError) Unwrap() []error {
+	return []error{e.Err, ErrSignature}
+}
+
+// VerifySignature checks signature against every accepted key in constant time
+// and returns the key that matched.
+func (a *Api) VerifySignature(data, sign string) (Key, error) {
+	received, err := hex.DecodeString(sign)
+	if err != nil || len(received) != 20 {
+		return Key{}, &SignatureError{Err: ErrSignatureMalformed, Signature: sign, Detail: fmt.Sprintf("%q", sign)}
+	}
+
+	keys := a.keys()
+	if len(keys) == 0 {
+		return Key{}, &SignatureError{Err: ErrSignatureMismatch, Signature: sign, Detail: ErrNoSecretKey.Error()}
+	}
+
+	var (
+		matched	Key
+		found	int
+	)
+	for _, key := range keys {
+		expected, _ := hex.DecodeString(signature(key.Secret, data))
+		if eq := subtle.ConstantTimeCompare(expected, received); eq == 1 && found == 0 {
+			matched, found = key, 1
+		}
+	}
+	if found == 0 {
+		return Key{}, &SignatureError{Err: ErrSignatureMismatch, Signature: sign}
+	}
+	return matched, nil
+}
+
+func (a *Api) checkSignature(response map[string]interface{}) (Key, error) {
+	data, hasData := response["data"].(string)
+	sign, hasSign := response["signature"].(string)
+
+	switch {
+	case hasData && hasSign:
+		return a.VerifySignature(data, sign)
+	case hasSign:
+		return Key{}, &SignatureError{Err: ErrSignatureMalformed, Signature: sign, Detail: "data is missing"}
+	}
+
+	// Fondy does not sign error responses, they are reported as is unless strict.
+	if err, ok := response["error_message"].(string); ok {
+		if !a.Options.StrictSignature {
+			return Key{}, errors.New(fmt.Sprintf("%v: %s", response["error_code"], err))
+		}
+		return Key{}, &SignatureError{Err: ErrSignatureMissing, Detail: fmt.Sprintf("%v: %s", response["error_code"], err)}
+	}
+	return Key{}, &SignatureError{Err: ErrSignatureMissing}
+}
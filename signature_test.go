@@ -0,0 +1,52 @@
+package fondy
+
+import (
+	"testing"
+	"errors"
+)
+
+func TestCheckSignature(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	data, _ := a.ToB64(map[string]interface{}{"order": map[string]interface{}{"order_id": "1"}})
+
+	for name, tc := range map[string]struct {
+		response	map[string]interface{}
+		err		error
+	}{
+		"valid": {map[string]interface{}{"data": data, "signature": a.GetSignature(data)}, nil},
+		"mismatch": {map[string]interface{}{"data": data, "signature": signature("other", data)}, ErrSignatureMismatch},
+		"malformed": {map[string]interface{}{"data": data, "signature": "not-hex"}, ErrSignatureMalformed},
+		"short": {map[string]interface{}{"data": data, "signature": "abcd"}, ErrSignatureMalformed},
+		"no data": {map[string]interface{}{"signature": a.GetSignature(data)}, ErrSignatureMalformed},
+		"missing": {map[string]interface{}{"data": data}, ErrSignatureMissing},
+	} {
+		err := a.CheckSignature(tc.response)
+		if tc.err == nil && err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if tc.err != nil && (!errors.Is(err, tc.err) || !errors.Is(err, ErrSignature)) {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestStrictSignature(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	failure := []byte(`{"response": {"response_status": "failure", "error_code": 1013, "error_message": "Duplicate order_id"}}`)
+	list := []byte(`{"response": [{"order_id": "1"}]}`)
+	token := []byte(`{"response": {"response_status": "success", "token": "abc"}}`)
+
+	var resp interface{}
+	if err := a.GetResponse(failure, &resp, true); err == nil || errors.Is(err, ErrSignature) {
+		t.Errorf("expected fondy error, got %v", err)
+	}
+	if err := a.GetResponse(list, &resp, true); err != nil {
+		t.Error(err.Error())
+	}
+
+	a.Options.StrictSignature = true
+	for _, content := range [][]byte{failure, list, token} {
+		if err := a.GetResponse(content, &resp, false); !errors.Is(err, ErrSignatureMissing) {
+			t.Errorf("unsigned response is accepted: %s: %v", content, err)
+		}
+	}
+}
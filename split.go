@@ -0,0 +1,212 @@
+package fondy
+
+import (
+	"github.com/satori/go.uuid"
+	"strconv"
+	"errors"
+	"fmt"
+)
+
+const (
+	ReceiverMerchant	= "merchant"
+	ReceiverRequisites	= "requisites"
+	ReceiverCard		= "card"
+)
+
+// FeeStrategy decides which receivers pay the fee of a split payment.
+type FeeStrategy int
+
+const (
+	FeeProportional	FeeStrategy = iota	// every receiver pays a share of the fee proportional to its part
+	FeeFirst				// the first receiver (usually the platform) pays the whole fee
+	FeeEqual				// every receiver pays an equal share
+)
+
+// SplitBuilder builds a Settlement that splits an order between receivers.
+// Amounts are in minor units, like the order amount.
+type SplitBuilder struct {
+	operationID	string
+	amount		int64
+	currency	string
+	description	string
+	fee		int64
+	strategy	FeeStrategy
+	receivers	[]Receiver
+	parts		[]int64
+}
+
+// NewSplit starts a split of order operationID with the given amount and currency.
+func NewSplit(operationID string, amount int64, currency string) *SplitBuilder {
+	return &SplitBuilder{operationID: operationID, amount: amount, currency: currency}
+}
+
+func (b *SplitBuilder) add(typ string, amount int64, requisites Requisites) *SplitBuilder {
+	b.receivers = append(b.receivers, Receiver{Type: typ, Requisites: &requisites})
+	b.parts = append(b.parts, amount)
+	return b
+}
+
+func (b *SplitBuilder) Description(description string) *SplitBuilder {
+	b.description = description
+	return b
+}
+
+// Merchant sends amount to another Fondy merchant.
+func (b *SplitBuilder) Merchant(merchantID int64, amount int64, description string) *SplitBuilder {
+	return b.add(ReceiverMerchant, amount, Requisites{MerchantID: merchantID, SettlementDescription: description})
+}
+
+// BankAccount sends amount to a legal entity account.
+func (b *SplitBuilder) BankAccount(okpo int64, jurName string, account int64, amount int64, description string) *SplitBuilder {
+	return b.add(ReceiverRequisites, amount, Requisites{Okpo: okpo, JurName: jurName, Account: account, SettlementDescription: description})
+}
+
+// Card sends amount to a card number.
+func (b *SplitBuilder) Card(cardNumber int64, amount int64, description string) *SplitBuilder {
+	return b.add(ReceiverCard, amount, Requisites{CardNumber: cardNumber, SettlementDescription: description})
+}
+
+// Rectoken sends amount to a card saved as rectoken.
+func (b *SplitBuilder) Rectoken(rectoken string, amount int64, description string) *SplitBuilder {
+	return b.add(ReceiverCard, amount, Requisites{Rectoken: rectoken, SettlementDescription: description})
+}
+
+// Fee deducts fee from receivers according to strategy.
+func (b *SplitBuilder) Fee(fee int64, strategy FeeStrategy) *SplitBuilder {
+	b.fee, b.strategy = fee, strategy
+	return b
+}
+
+// Allocation returns the amount every receiver gets after the fee.
+func (b *SplitBuilder) Allocation() ([]int64, error) {
+	if len(b.parts) == 0 {
+		return nil, errors.New("Split has no receivers")
+	}
+	if b.fee < 0 || b.fee >= b.amount {
+		return nil, errors.New(fmt.Sprintf("Split fee %d must be less than amount %d", b.fee, b.amount))
+	}
+
+	var total int64
+	for i, part := range b.parts {
+		if part <= 0 {
+			return nil, errors.New(fmt.Sprintf("Split receiver %d: amount must be positive", i))
+		}
+		total += part
+	}
+	if total != b.amount {
+		return nil, errors.New(fmt.Sprintf("Split parts %d != order amount %d", total, b.amount))
+	}
+
+	shares := make([]int64, len(b.parts))
+	switch b.strategy {
+	case FeeFirst:
+		shares[0] = b.fee
+	case FeeEqual:
+		for i := range shares {
+			shares[i] = b.fee / int64(len(shares))
+		}
+		shares[0] += b.fee % int64(len(shares))
+	default:
+		var allocated int64
+		largest := 0
+		for i, part := range b.parts {
+			shares[i] = b.fee * part / total
+			allocated += shares[i]
+			if part > b.parts[largest] {
+				largest = i
+			}
+		}
+		shares[largest] += b.fee - allocated
+	}
+
+	output := make([]int64, len(b.parts))
+	for i, part := range b.parts {
+		if output[i] = part - shares[i]; output[i] <= 0 {
+			return nil, errors.New(fmt.Sprintf("Split receiver %d: fee share %d exceeds amount %d", i, shares[i], part))
+		}
+	}
+	return output, nil
+}
+
+// Build validates parts against the order amount and currency and returns the settlement,
+// its amount is the order amount less the fee.
+func (b *SplitBuilder) Build() (*Settlement, error) {
+	if b.operationID == "" {
+		return nil, errors.New("Split operation_id is required")
+	}
+	if len(b.currency) != 3 {
+		return nil, errors.New("Split currency must be ISO 4217 code: " + b.currency)
+	}
+
+	allocation, err := b.Allocation()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	receivers := make([]Receiver, len(b.receivers))
+	for i, receiver := range b.receivers {
+		requisites := *receiver.Requisites
+		requisites.Amount = float64(allocation[i])
+		receivers[i] = Receiver{Type: receiver.Type, Requisites: &requisites}
+		total += allocation[i]
+	}
+
+	return &Settlement{
+		OperationID: b.operationID,
+		Amount: strconv.FormatInt(total, 10),
+		Currency: b.currency,
+		OrderType: "settlement",
+		OrderDesc: b.description,
+		Receiver: receivers,
+	}, nil
+}
+
+// Split checks the parts against the original order, builds and sends the settlement.
+func (a *Api) Split(b *SplitBuilder) (*SettlementResult, error) {
+	order, err := a.GetOrderStatus(b.operationID)
+	if err != nil {
+		return nil, err
+	}
+	if amount := toString(order["amount"]); amount != strconv.FormatInt(b.amount, 10) {
+		return nil, errors.New(fmt.Sprintf("Split amount %d != order amount %s", b.amount, amount))
+	}
+	if currency := toString(order["currency"]); currency != b.currency {
+		return nil, errors.New(fmt.Sprintf("Split currency %s != order currency %s", b.currency, currency))
+	}
+
+	data, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return a.SettlementDetails(data)
+}
+
+// ReceiverResult is a settlement receiver as returned by Fondy.
+type ReceiverResult struct {
+	Type					string 		`json:"type"`
+	Requisites				Requisites	`json:"requisites"`
+	Status					string 		`json:"status"`
+}
+
+type SettlementResult struct {
+	PaymentID				int64 		`json:"payment_id"`
+	OrderID					string 		`json:"order_id"`
+	OrderStatus				string 		`json:"order_status"`
+	Receivers				[]ReceiverResult	`json:"receiver"`
+}
+
+// SettlementDetails is Settlement that returns per receiver results.
+func (a *Api) SettlementDetails(data *Settlement) (*SettlementResult, error) {
+	var resp struct {
+		Response
+		Order SettlementResult `json:"order"`
+	}
+	if data.OrderID == "" {
+		data.OrderID = uuid.NewV4().String()
+	}
+	if err := a.post("/settlement/", data, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp.Order, resp.GetError()
+}
@@ -0,0 +1,74 @@
+package fondy
+
+import (
+	"testing"
+)
+
+func TestSplitAllocation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		strategy	FeeStrategy
+		expected	[3]int64
+	}{
+		"proportional": {FeeProportional, [3]int64{6790, 2619, 291}},
+		"first": {FeeFirst, [3]int64{6700, 2700, 300}},
+		"equal": {FeeEqual, [3]int64{6900, 2600, 200}},
+	} {
+		allocation, err := NewSplit("order-1", 10000, "UAH").
+			Merchant(600001, 7000, "platform").
+			BankAccount(12345678, "LLC Seller", 26001234567890, 2700, "seller").
+			Card(4444555566661111, 300, "courier").
+			Fee(300, tc.strategy).
+			Allocation()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if [3]int64{allocation[0], allocation[1], allocation[2]} != tc.expected {
+			t.Errorf("%s: unexpected allocation %v", name, allocation)
+		}
+	}
+
+	settlement, err := NewSplit("order-1", 1000, "UAH").Merchant(600001, 500, "").Rectoken("token", 500, "").Build()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if settlement.Amount != "1000" || settlement.Receiver[1].Type != ReceiverCard || settlement.Receiver[1].Requisites.Amount != 500 {
+		t.Errorf("unexpected settlement: %+v", settlement)
+	}
+
+	for name, b := range map[string]*SplitBuilder{
+		"total": NewSplit("order-1", 1000, "UAH").Merchant(1, 400, "").Merchant(2, 500, ""),
+		"empty": NewSplit("order-1", 1000, "UAH"),
+		"currency": NewSplit("order-1", 1000, "hryvnia").Merchant(1, 1000, ""),
+		"fee": NewSplit("order-1", 1000, "UAH").Merchant(1, 900, "").Merchant(2, 100, "").Fee(150, FeeFirst).Fee(950, FeeFirst),
+	} {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: invalid split is accepted", name)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	a := NewApi(&ApiOptions{MerchantID: 1396424, SecretKey: "test"})
+	server := fakeFondy(t, a, func(endpoint string, order map[string]interface{}) interface{} {
+		if endpoint == "status/order_id" {
+			return map[string]interface{}{"order": map[string]interface{}{"order_id": order["order_id"], "amount": 1000, "currency": "UAH"}}
+		}
+		return map[string]interface{}{"order": map[string]interface{}{
+			"payment_id": 77,
+			"order_status": "created",
+			"receiver": order["receiver"],
+		}}
+	})
+	defer server.Close()
+
+	result, err := a.Split(NewSplit("order-1", 1000, "UAH").Merchant(600001, 600, "").Merchant(700001, 400, ""))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.PaymentID != 77 || len(result.Receivers) != 2 || result.Receivers[1].Requisites.MerchantID != 700001 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	if _, err := a.Split(NewSplit("order-1", 900, "UAH").Merchant(600001, 900, "")); err == nil {
+		t.Error("split of a different amount is accepted")
+	}
+}
@@ -0,0 +1,73 @@
+package fondy
+
+import (
+	"net/http"
+	"context"
+)
+
+// Tracer starts spans for api calls, see package fondyotel for an OpenTelemetry adapter.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// Propagator is implemented by tracers able to inject trace headers into outgoing requests.
+type Propagator interface {
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Linker is implemented by tracers able to link a callback span to the span of
+// the api call that created the order.
+type Linker interface {
+	StartLinked(ctx context.Context, name string, orderID string) (context.Context, Span)
+}
+
+// TracingMiddleware wraps every api call in a span named after the endpoint.
+func TracingMiddleware(tracer Tracer) Middleware {
+	return func(next Handler) Handler {
+		return func(ex *Exchange) error {
+			ctx, span := tracer.Start(ex.Context, "fondy " + ex.Endpoint)
+			defer span.End()
+
+			ex.Context = ctx
+			span.SetAttribute("fondy.endpoint", ex.Endpoint)
+			span.SetAttribute("fondy.merchant_id", ex.api.Options.MerchantID)
+			span.SetAttribute("fondy.order_id", ex.OrderID())
+			if p, ok := tracer.(Propagator); ok {
+				p.Inject(ctx, ex.Header)
+			}
+
+			err := next(ex)
+
+			if ex.StatusCode > 0 {
+				span.SetAttribute("http.response.status_code", ex.StatusCode)
+			}
+			if code := ex.Result().ErrorCode; code > 0 {
+				span.SetAttribute("fondy.error_code", code)
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+			return err
+		}
+	}
+}
+
+// TraceCallback starts a span for handling a callback of the order, linked to the
+// originating api call when the tracer supports it.
+func TraceCallback(ctx context.Context, tracer Tracer, orderID string, merchantID int64) (context.Context, Span) {
+	var span Span
+	if l, ok := tracer.(Linker); ok {
+		ctx, span = l.StartLinked(ctx, "fondy callback", orderID)
+	} else {
+		ctx, span = tracer.Start(ctx, "fondy callback")
+	}
+	span.SetAttribute("fondy.order_id", orderID)
+	span.SetAttribute("fondy.merchant_id", merchantID)
+	return ctx, span
+}